@@ -0,0 +1,105 @@
+package gopherpack
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// skew is not reported if worker processes accepted fewer connections within AcceptSkewInterval in total
+const minAcceptSkewSamples = 100
+
+// acceptCountingListener counts connections accepted by worker process
+type acceptCountingListener struct {
+	net.Listener
+	state *packState
+}
+
+func (l *acceptCountingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt64(&l.state.acceptedConnections, 1)
+	}
+
+	return conn, err
+}
+
+// wrapWithAcceptCounter wraps listener to count accepted connections if AcceptSkewInterval is set
+func (p *Pack) wrapWithAcceptCounter(l net.Listener) net.Listener {
+	if p.cfg.AcceptSkewInterval <= 0 {
+		return l
+	}
+
+	return &acceptCountingListener{Listener: l, state: p.state}
+}
+
+// reportAccepts periodically tells main process how many connections servers of the pack accepted so far
+func (p *Pack) reportAccepts() {
+	ticker := time.NewTicker(p.cfg.AcceptSkewInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.notifyMainProcess(msgAccepts, strconv.FormatInt(atomic.LoadInt64(&p.state.acceptedConnections), 10))
+	}
+}
+
+// setAccepted remembers number of connections accepted by worker process so far
+func (s *supervisor) setAccepted(process *os.Process, payload string) {
+	accepted, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		s.warnf("Main process PID=%d invalid number of accepted connections from worker process PID=%d: %q\n",
+			pid, process.Pid, payload)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.accepted = accepted
+			break
+		}
+	}
+}
+
+// monitorAcceptSkew periodically compares numbers of connections accepted by worker processes
+// and warns if busiest one accepted more than AcceptSkewThreshold times of average, i.e. because
+// SO_REUSEPORT distributes connections by hash of their addresses which can be uneven for few clients
+func (s *supervisor) monitorAcceptSkew() {
+	ticker := time.NewTicker(s.cfg.AcceptSkewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stopChan:
+			return
+		}
+		s.mu.Lock()
+		var total, busiest int64
+		busiestPID, numWorkers := 0, 0
+		for _, w := range s.workers {
+			if w.process == nil || !w.ready {
+				continue
+			}
+			accepted := w.accepted - w.acceptedChecked
+			w.acceptedChecked = w.accepted
+			total += accepted
+			numWorkers++
+			if accepted > busiest {
+				busiest = accepted
+				busiestPID = w.process.Pid
+			}
+		}
+		s.mu.Unlock()
+
+		if numWorkers < 2 || total < minAcceptSkewSamples {
+			continue
+		}
+		average := float64(total) / float64(numWorkers)
+		if float64(busiest) > s.cfg.AcceptSkewThreshold*average {
+			s.warnf("Main process PID=%d connections are unevenly distributed between worker processes: "+
+				"worker process PID=%d accepted %d of %d connections within %s, average is %.1f\n",
+				pid, busiestPID, busiest, total, s.cfg.AcceptSkewInterval, average)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package gopherpack
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToDevice binds socket to network interface of BindToDevice with SO_BINDTODEVICE (except unix socket)
+func (p *Pack) bindToDevice(network string, fd uintptr) error {
+	if p.cfg.BindToDevice == "" || isUnixNetwork(network) {
+		return nil
+	}
+	err := unix.BindToDevice(int(fd), p.cfg.BindToDevice)
+	if errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("could not bind to device %s, process needs CAP_NET_RAW capability: %w", p.cfg.BindToDevice, err)
+	}
+	if err != nil {
+		return fmt.Errorf("could not bind to device %s: %w", p.cfg.BindToDevice, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package gopherpack
+
+import "errors"
+
+// bindToDevice returns error if BindToDevice is set, SO_BINDTODEVICE is not available on this platform
+func (p *Pack) bindToDevice(network string, fd uintptr) error {
+	if p.cfg.BindToDevice == "" {
+		return nil
+	}
+
+	return errors.New("BindToDevice is supported only on Linux")
+}
@@ -0,0 +1,499 @@
+package gopherpack
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Config holds settings of a pack, use DefaultConfig to get a config populated with package-level settings
+// and change it as needed, zero values of fields are not replaced with defaults (see New)
+type Config struct {
+	// Logger can be set to client's logging which should implements StdLogger,
+	// default is Go's standard logger with output to stdout
+	Logger StdLogger
+
+	// StructuredLogger is used instead of Logger if it is set (i.e. *slog.Logger), messages are logged along with
+	// "pid", "process" and "core" (for pinned worker process) key/value pairs
+	StructuredLogger LeveledLogger
+
+	// WorkerCount is number of worker processes to start,
+	// zero value means one worker per each CPU core main process is allowed to run on, limited by CPU quota of cgroup
+	WorkerCount int
+
+	// MaxRestarts is maximum number of times in a row each worker process is restarted after unexpected exit,
+	// zero value disables restarts, negative value means no limit. Count is reset once worker process stays up
+	// for 10 times RestartBackoff (at least a minute), so occasional crashes of long running worker process
+	// don't use the limit up
+	MaxRestarts int
+
+	// RestartBackoff is how long main process waits before restarting exited worker process
+	RestartBackoff time.Duration
+
+	// UpgradeGraceInterval controls how long previous and new main processes co-exist during executable upgrade,
+	// new main process terminates previous one as soon as its workers are ready, if they are not ready
+	// within this interval new main process stops and previous one keeps serving (see UpgradeRetries)
+	UpgradeGraceInterval time.Duration
+
+	// ShutdownTimeout limits how long worker process waits for graceful shutdown of a server,
+	// zero value means no limit. Time taken by OnServerShutdown and OnServerShutdownContext beyond
+	// PreShutdownDelay is counted against it
+	ShutdownTimeout time.Duration
+
+	// DisableAffinity disables placing each worker process on its own CPU core,
+	// worker processes are not pinned and Go scheduler uses all CPU cores in each of them
+	DisableAffinity bool
+
+	// SharedListener makes main process to create listener once and pass it to worker processes
+	// (and to new main process during executable upgrade) instead of each worker process creating its own one,
+	// so all workers share exactly one listening socket. It works only if main process is started by ListenAndServe* functions,
+	// listener is shared regardless of this setting if kernel does not support SO_REUSEPORT
+	SharedListener bool
+
+	// ReloadSignals are signals which make main process to start executable upgrade, default is SIGUSR2
+	ReloadSignals []os.Signal
+
+	// ShutdownSignals are signals which make main process and worker processes to shutdown gracefully,
+	// main process propagates received signal to worker processes, default is SIGINT, SIGTERM and SIGQUIT
+	ShutdownSignals []os.Signal
+
+	// SingleProcess makes ListenAndServe* functions to run server directly in current process
+	// without forking worker processes and without placing it on a CPU core, i.e. for integration tests
+	SingleProcess bool
+
+	// StrictReusePort makes failure to set SO_REUSEPORT on listening socket an error,
+	// by default it is logged and listener gets created without it (worker processes might fail to share the port then)
+	StrictReusePort bool
+
+	// IPv6Mode controls IPV6_V6ONLY option of IPv6 listening sockets (i.e. when listening on "tcp" network and ":8080" address),
+	// use "tcp4" or "udp4" network for IPv4-only listener
+	IPv6Mode IPv6Binding
+
+	// RemoveStaleUnixSocket makes worker process to remove unix socket file (i.e. left after a crash) before listening on it,
+	// socket file is removed only if nobody listens on it. Note that only one process can listen on unix socket path
+	// (SO_REUSEPORT does not apply to unix sockets) so use SharedListener to serve unix socket by all worker processes
+	RemoveStaleUnixSocket bool
+
+	// UnixSocketMode sets permissions of unix socket file after listener is created, zero value keeps default permissions.
+	// On Linux address starting with "@" (i.e. "@myservice") is in abstract namespace, it has no socket file,
+	// so neither RemoveStaleUnixSocket nor UnixSocketMode apply to it
+	UnixSocketMode os.FileMode
+
+	// PreShutdownDelay is how long worker process keeps serving after it received a signal to shutdown,
+	// IsReady returns false during the delay so load balancers have time to deregister worker process before it stops accepting connections
+	PreShutdownDelay time.Duration
+
+	// HealthChecks makes HTTP server of worker process to serve liveness ("/healthz") and readiness ("/readyz") endpoints,
+	// they respond with 200 while worker process is serving and with 503 once its shutdown has begun
+	HealthChecks bool
+
+	// MinWorkers is minimum number of worker processes which must be started by main process,
+	// main process returns error right away if fewer worker processes could be forked, zero value means at least one
+	MinWorkers int
+
+	// ExecutablePath is path to executable started as worker process and as new main process during executable upgrade,
+	// by default it is os.Args[0] resolved with exec.LookPath (on Linux it is running executable for worker processes
+	// and executable at path of running one for new main process, see README)
+	ExecutablePath string
+
+	// ExecutableArgs are arguments (including program name as first argument) passed to worker process
+	// and to new main process during executable upgrade, by default it is os.Args
+	ExecutableArgs []string
+
+	// MaxConcurrentHandlers limits number of connection handlers run concurrently by TCP server of worker process,
+	// zero value means no limit
+	MaxConcurrentHandlers int
+
+	// HandlerLimitPolicy controls what TCP server does with new connection when MaxConcurrentHandlers is reached,
+	// by default it waits for a free handler
+	HandlerLimitPolicy HandlerLimitAction
+
+	// H2C makes HTTP server without TLS to serve HTTP/2 cleartext (h2c) both with prior knowledge and via upgrade from HTTP/1.1,
+	// i.e. when TLS is terminated by load balancer
+	H2C bool
+
+	// TCPKeepAlive is keep-alive period of connections accepted by TCP server,
+	// zero value keeps Go default (keep-alive enabled), negative value disables keep-alive
+	TCPKeepAlive time.Duration
+
+	// TCPLinger sets SO_LINGER (in seconds) of connections accepted by TCP server, zero value keeps system default,
+	// negative value makes Close to discard unsent data and to reset connection
+	TCPLinger int
+
+	// TCPReadTimeout is read deadline set before each read from connection accepted by TCP server, zero value means no deadline.
+	// Deadline set by handler (or by TLS handshake within TLSHandshakeTimeout) takes precedence until it is reset to zero.
+	// Connection passed to handler is wrapped if TCPReadTimeout or TCPWriteTimeout is set, its NetConn method
+	// returns wrapped *net.TCPConn (as tls.Conn does)
+	TCPReadTimeout time.Duration
+
+	// TCPWriteTimeout is write deadline set before each write to connection accepted by TCP server, zero value means no deadline
+	TCPWriteTimeout time.Duration
+
+	// ListenConfig is used to create listeners (i.e. to set KeepAlive), its Control is called after socket options
+	// of the pack (SO_REUSEADDR, SO_REUSEPORT, SocketControl) are set so they are always enforced
+	ListenConfig *net.ListenConfig
+
+	// HeartbeatTimeout enables heartbeats of worker processes, main process terminates ready worker process
+	// which has not sent heartbeat within the timeout (and kills it if it does not exit within the timeout too),
+	// so supervisor replaces it. Main process and worker processes must use the same HeartbeatTimeout
+	HeartbeatTimeout time.Duration
+
+	// ForceKillTimeout is how long main process waits for worker processes to exit after propagating shutdown signal,
+	// worker processes which are still running after the timeout get killed, zero value means no limit
+	ForceKillTimeout time.Duration
+
+	// LogConnections makes TCP server to log each accepted connection (at debug level), it is off by default
+	// as logging in accept loop slows down busy servers
+	LogConnections bool
+
+	// WorkerUID and WorkerGID are user and group worker processes run as (supplementary groups are dropped), zero value keeps
+	// ones of main process. Use with SharedListener to bind privileged port (i.e. 80) in main process running as root
+	// while worker processes never have the privilege. Not supported on Windows
+	WorkerUID int
+	WorkerGID int
+
+	// WorkerSysProcAttr is copied into attributes of each worker process (i.e. to set Setpgid or Pdeathsig),
+	// its Credential takes precedence over WorkerUID and WorkerGID
+	WorkerSysProcAttr *syscall.SysProcAttr
+
+	// ParentDeathSignal is sent by kernel to worker process when main process dies (i.e. killed with SIGKILL) so worker processes
+	// don't keep serving orphaned, default is SIGTERM, zero value disables it. Supported on Linux only
+	ParentDeathSignal syscall.Signal
+
+	// TLSHandshakeTimeout limits how long TLS handshake of connection accepted by TCP server can take, handshake is done
+	// before connection is passed to handler and connection is closed if it does not complete in time. Zero value means no limit
+	TLSHandshakeTimeout time.Duration
+
+	// WorkerGOMAXPROCS is GOMAXPROCS of worker process placed on CPU core, default is 1 (zero value means 1 too),
+	// negative value keeps Go default. It may be worth to raise it for workloads doing a lot of blocking syscalls
+	WorkerGOMAXPROCS int
+
+	// NUMAAffinity makes main process to place each worker process on all CPU cores of a NUMA node instead of single CPU core,
+	// worker processes are distributed over NUMA nodes round-robin (consider raising WorkerGOMAXPROCS then),
+	// only CPU cores main process is allowed to run on are used. Each worker process still gets a primary CPU core
+	// reported by CoreFromContext and OnWorkerStart. NUMA topology is read from /sys/devices/system/node on Linux
+	NUMAAffinity bool
+
+	// IgnoreCPUQuota makes main process to start one worker process per each allowed CPU core even if CPU quota of cgroup
+	// (i.e. of container) is lower, it does not matter if WorkerCount is set
+	IgnoreCPUQuota bool
+
+	// DrainSignals are signals which make worker process to start draining: it keeps serving but its readiness
+	// endpoint responds with 503 so load balancers route new traffic away, default is SIGUSR1 (see Drain)
+	DrainSignals []os.Signal
+
+	// UndrainSignals are signals which make draining worker process to be ready again, there are none by default
+	// so draining is stopped by Undrain only. SIGUSR2 is not a good choice as it starts executable upgrade
+	// if sent to main process (i.e. to process group)
+	UndrainSignals []os.Signal
+
+	// ProxyProtocol makes TCP and HTTP servers to parse PROXY protocol v1 or v2 header (sent by L4 load balancers
+	// like HAProxy or AWS NLB) of accepted connections, so RemoteAddr of connection is the address of real client.
+	// Optional mode waits for first bytes sent by client, so it does not suit protocols where server speaks first
+	ProxyProtocol ProxyProtocolMode
+
+	// CountBytes makes TCP server to count bytes read from and written to accepted connections (including TLS overhead),
+	// see BytesRead and BytesWritten. Connection passed to handler is wrapped, its NetConn method returns wrapped *net.TCPConn
+	CountBytes bool
+
+	// UpgradeRetries is how many times main process retries executable upgrade if new main process could not be started
+	// or exited before taking over (i.e. its workers were not ready within UpgradeGraceInterval), default is no retries
+	UpgradeRetries int
+
+	// UpgradeRetryBackoff is how long main process waits before retrying failed executable upgrade
+	UpgradeRetryBackoff time.Duration
+
+	// PIDFile is a path of file main process writes its PID to, new main process started by executable upgrade
+	// rewrites it once its workers are ready, the file is removed on exit by main process whose PID it contains
+	PIDFile string
+
+	// ShareTLSSessionTickets makes main process to generate TLS session ticket key shared by all its worker processes,
+	// so TLS session started with one worker process can be resumed by any other one (TCP and HTTP servers use it
+	// automatically, see TLSSessionTicketKeys for gRPC server), new main process started by upgrade generates new key
+	ShareTLSSessionTickets bool
+
+	// WorkerMaxLifetime makes main process to gracefully replace worker processes running longer than this duration
+	// (i.e. to bound memory fragmentation), worker processes are recycled one at a time, recycling is not counted as restart
+	WorkerMaxLifetime time.Duration
+
+	// MaxRequests makes worker process of HTTP server to shutdown gracefully after serving this number of requests
+	// (i.e. to bound impact of slow memory leaks), zero means no limit. Main process recycles worker processes
+	// which reached the limit one at a time as WorkerMaxLifetime does, so they keep serving until their turn comes
+	MaxRequests int
+
+	// SendBufferSize and RecvBufferSize set SO_SNDBUF and SO_RCVBUF of listening sockets in bytes (accepted connections
+	// inherit them), on Linux SO_SNDBUFFORCE and SO_RCVBUFFORCE are used if process is privileged to exceed
+	// limits of net.core.wmem_max and net.core.rmem_max, a warning is logged if kernel clamps the size
+	SendBufferSize int
+	RecvBufferSize int
+
+	// TCPNoDelay controls TCP_NODELAY of connections accepted by TCP server, default is true which disables Nagle's algorithm
+	// as Go does for all TCP connections, setting it to false makes small writes to be coalesced
+	TCPNoDelay bool
+
+	// AcceptSkewInterval makes main process to compare numbers of connections accepted by worker processes
+	// within this interval and to warn if distribution of connections by SO_REUSEPORT is uneven (see AcceptSkewThreshold)
+	AcceptSkewInterval time.Duration
+
+	// AcceptSkewThreshold is how many times more connections than average worker process has to accept
+	// to be reported by AcceptSkewInterval check, default is 2
+	AcceptSkewThreshold float64
+
+	// BindRetries is how many times worker process retries to bind address which is already in use
+	// (i.e. by exiting process during fast restart or upgrade) before giving up, other errors are not retried
+	BindRetries int
+
+	// BindRetryInterval is how long to wait before first retry of BindRetries, it doubles after each attempt
+	BindRetryInterval time.Duration
+
+	// MainAlsoServes makes main process of HTTP, TCP and gRPC servers to serve too instead of one worker process,
+	// i.e. for small deployments where dedicated main process wastes a CPU core. Main process is not pinned to CPU core
+	// and is not recycled, during executable upgrade previous main process stops serving only once new one takes over
+	// (so both serve for a while), if server of main process fails worker processes keep serving
+	MainAlsoServes bool
+
+	// PackReadyTimeout is how long main process waits for all worker processes to get ready before calling OnPackReady
+	// with error
+	PackReadyTimeout time.Duration
+
+	// ConfigReloadSignals are signals which make main process to relay them to ready worker processes which reload
+	// TLSCertFile and call OnConfigReload then (if they are set) without being restarted, default is SIGHUP
+	ConfigReloadSignals []os.Signal
+
+	// TLSCertFile and TLSKeyFile are PEM encoded certificate and key which worker processes serve with
+	// TLS servers (see SetCertificate) and reload on ConfigReloadSignals without dropping connections
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// LogDiagnostics makes main process to log report of DumpDiagnostics on start
+	LogDiagnostics bool
+
+	// BindToDevice binds listening sockets to network interface with this name (i.e. to be reachable only
+	// on management interface) via SO_BINDTODEVICE, it is supported only on Linux and may require CAP_NET_RAW
+	BindToDevice string
+
+	// WorkerMaxMemory makes main process to gracefully replace worker processes whose resident memory exceeds
+	// this number of bytes before OOM killer drops their in-flight requests, workers are recycled one at a time
+	WorkerMaxMemory int64
+
+	// MemoryCheckInterval is how often worker processes report their memory usage if WorkerMaxMemory is set
+	MemoryCheckInterval time.Duration
+
+	// ResourceReportInterval makes worker processes to report number of their goroutines and open file descriptors
+	// to main process with this interval, they are shown by PackStatus (i.e. to pinpoint worker process leaking handlers)
+	ResourceReportInterval time.Duration
+
+	// ForkStagger is a delay between forks of worker processes on start, i.e. to keep worker processes of large machines
+	// from hitting database or cache all at once while initializing, main process handles signals once all of them are forked
+	ForkStagger time.Duration
+
+	// OnSIGUSR2 is called in main process before starting executable upgrade process
+	//
+	// Deprecated: use OnUpgrade which can abort executable upgrade
+	OnSIGUSR2 func()
+
+	// OnUpgrade is called in main process before starting executable upgrade process,
+	// returning non nil error (or panicking) aborts the upgrade, i.e. if new executable fails self-check
+	OnUpgrade func() error
+
+	// OnWorkersStarted is called in main process after worker processes are forked
+	// and before main process starts waiting for signals, it receives PIDs of worker processes
+	// (zero PID means worker process could not be started)
+	OnWorkersStarted func(pids []int)
+
+	// OnServerShutdown is called in worker process before doing graceful server shutdown
+	OnServerShutdown func()
+
+	// OnWorkerStart is called in worker process after its runtime is set up and before it starts serving,
+	// it receives CPU core number worker process was placed on (-1 if it is not placed on a CPU core)
+	OnWorkerStart func(cpuCore int)
+
+	// OnWorkerForked is called in main process each time worker process is started or restarted
+	OnWorkerForked func(pid int, cpuCore int)
+
+	// OnWorkerExited is called in main process each time worker process exits
+	OnWorkerExited func(pid int, state *os.ProcessState)
+
+	// OnConnectionAccepted is called in worker process of TCP server each time new connection is accepted
+	OnConnectionAccepted func(remote net.Addr)
+
+	// OnUpgradeResult is called in main process after new main process was started during executable upgrade,
+	// it receives PID of new main process or error if it could not be started, it is called once again
+	// with error if new main process exits before taking over (i.e. its workers were not ready)
+	OnUpgradeResult func(newPID int, err error)
+
+	// SocketControl is called for each listening socket after default socket options are set
+	// to set additional socket options (i.e. SO_RCVBUF), its error is returned along with errors of default options
+	SocketControl func(fd uintptr) error
+
+	// ExtraWorkerEnv is called in main process each time worker process is forked, returned env vars ("name=value")
+	// are added to environment of worker process (i.e. to pass shard number), workerIndex is from 0 to number of workers - 1
+	// (environment of main process is taken once on first fork, so vars it sets later are passed only this way)
+	ExtraWorkerEnv func(workerIndex int) []string
+
+	// OnMainShutdown is called in main process after all worker processes exited during shutdown
+	// and before main process returns, i.e. to flush metrics or close resources of main process
+	OnMainShutdown func()
+
+	// OnHeartbeat is called in worker process before each heartbeat is sent (see HeartbeatTimeout), returning non nil error
+	// (or panicking) skips the heartbeat, i.e. if worker process detects it is stuck
+	OnHeartbeat func() error
+
+	// OnColdStart is called in main process before forking worker processes if main process was not started by executable upgrade,
+	// i.e. to run migrations or warmup
+	OnColdStart func()
+
+	// OnReload is called in main process before forking worker processes if main process was started by executable upgrade,
+	// it receives PID of previous main process
+	OnReload func(prevPID int)
+
+	// ConnFilter is called in worker process for each accepted TCP connection before its handler,
+	// connection is closed without calling handler if it returns false (or panics), i.e. to allow or deny source IPs,
+	// it is called from accept loop so it should be fast
+	ConnFilter func(conn net.Conn) bool
+
+	// OnPackReady is called in main process once all worker processes report they are ready to serve,
+	// i.e. to register the service in discovery or to write a ready file, err wraps ErrPackNotReady
+	// if only part of worker processes got ready within PackReadyTimeout
+	OnPackReady func(err error)
+
+	// OnServerShutdownContext is the same as OnServerShutdown (and is called right after it) but ctx is done
+	// once shutdown budget of PreShutdownDelay plus ShutdownTimeout is spent, so slow cleanup can stop in time
+	OnServerShutdownContext func(ctx context.Context)
+
+	// OnConfigReload is called in worker process on ConfigReloadSignals to apply new config in place,
+	// i.e. to swap HTTP handler or to reload TLS certificates, worker process keeps previous config if it returns error,
+	// error wrapping ErrUpgradeRequired makes main process to do executable upgrade instead
+	OnConfigReload func() error
+
+	// OnAcceptError is called in worker process when TCP server fails to accept connection (except when it is shut down),
+	// i.e. to count errors, returning true makes server to retry with backoff and false makes it to stop and return err,
+	// server retries on temporary errors only if hook is not set
+	OnAcceptError func(err error) (retry bool)
+}
+
+// DefaultConfig returns Config populated with package-level settings
+func DefaultConfig() Config {
+	return Config{
+		Logger:                  Logger,
+		StructuredLogger:        StructuredLogger,
+		WorkerCount:             WorkerCount,
+		MaxRestarts:             MaxRestarts,
+		RestartBackoff:          RestartBackoff,
+		UpgradeGraceInterval:    UpgradeGraceInterval,
+		ShutdownTimeout:         ShutdownTimeout,
+		DisableAffinity:         DisableAffinity,
+		SharedListener:          SharedListener,
+		ReloadSignals:           ReloadSignals,
+		ShutdownSignals:         ShutdownSignals,
+		SingleProcess:           SingleProcess,
+		StrictReusePort:         StrictReusePort,
+		IPv6Mode:                IPv6Mode,
+		RemoveStaleUnixSocket:   RemoveStaleUnixSocket,
+		UnixSocketMode:          UnixSocketMode,
+		PreShutdownDelay:        PreShutdownDelay,
+		HealthChecks:            HealthChecks,
+		MinWorkers:              MinWorkers,
+		ExecutablePath:          ExecutablePath,
+		ExecutableArgs:          ExecutableArgs,
+		MaxConcurrentHandlers:   MaxConcurrentHandlers,
+		HandlerLimitPolicy:      HandlerLimitPolicy,
+		H2C:                     H2C,
+		TCPKeepAlive:            TCPKeepAlive,
+		TCPLinger:               TCPLinger,
+		TCPReadTimeout:          TCPReadTimeout,
+		TCPWriteTimeout:         TCPWriteTimeout,
+		ListenConfig:            ListenConfig,
+		HeartbeatTimeout:        HeartbeatTimeout,
+		ForceKillTimeout:        ForceKillTimeout,
+		LogConnections:          LogConnections,
+		WorkerUID:               WorkerUID,
+		WorkerGID:               WorkerGID,
+		WorkerSysProcAttr:       WorkerSysProcAttr,
+		ParentDeathSignal:       ParentDeathSignal,
+		TLSHandshakeTimeout:     TLSHandshakeTimeout,
+		WorkerGOMAXPROCS:        WorkerGOMAXPROCS,
+		NUMAAffinity:            NUMAAffinity,
+		IgnoreCPUQuota:          IgnoreCPUQuota,
+		DrainSignals:            DrainSignals,
+		UndrainSignals:          UndrainSignals,
+		ProxyProtocol:           ProxyProtocol,
+		CountBytes:              CountBytes,
+		UpgradeRetries:          UpgradeRetries,
+		UpgradeRetryBackoff:     UpgradeRetryBackoff,
+		PIDFile:                 PIDFile,
+		ShareTLSSessionTickets:  ShareTLSSessionTickets,
+		WorkerMaxLifetime:       WorkerMaxLifetime,
+		MaxRequests:             MaxRequests,
+		SendBufferSize:          SendBufferSize,
+		RecvBufferSize:          RecvBufferSize,
+		TCPNoDelay:              TCPNoDelay,
+		AcceptSkewInterval:      AcceptSkewInterval,
+		AcceptSkewThreshold:     AcceptSkewThreshold,
+		BindRetries:             BindRetries,
+		BindRetryInterval:       BindRetryInterval,
+		MainAlsoServes:          MainAlsoServes,
+		PackReadyTimeout:        PackReadyTimeout,
+		ConfigReloadSignals:     ConfigReloadSignals,
+		TLSCertFile:             TLSCertFile,
+		TLSKeyFile:              TLSKeyFile,
+		LogDiagnostics:          LogDiagnostics,
+		BindToDevice:            BindToDevice,
+		WorkerMaxMemory:         WorkerMaxMemory,
+		MemoryCheckInterval:     MemoryCheckInterval,
+		ResourceReportInterval:  ResourceReportInterval,
+		ForkStagger:             ForkStagger,
+		OnSIGUSR2:               OnSIGUSR2,
+		OnUpgrade:               OnUpgrade,
+		OnWorkersStarted:        OnWorkersStarted,
+		OnServerShutdown:        OnServerShutdown,
+		OnWorkerStart:           OnWorkerStart,
+		OnWorkerForked:          OnWorkerForked,
+		OnWorkerExited:          OnWorkerExited,
+		OnConnectionAccepted:    OnConnectionAccepted,
+		OnUpgradeResult:         OnUpgradeResult,
+		SocketControl:           SocketControl,
+		ExtraWorkerEnv:          ExtraWorkerEnv,
+		OnMainShutdown:          OnMainShutdown,
+		OnHeartbeat:             OnHeartbeat,
+		OnColdStart:             OnColdStart,
+		OnReload:                OnReload,
+		ConnFilter:              ConnFilter,
+		OnPackReady:             OnPackReady,
+		OnServerShutdownContext: OnServerShutdownContext,
+		OnConfigReload:          OnConfigReload,
+		OnAcceptError:           OnAcceptError,
+	}
+}
+
+// Pack runs main process or worker process of a pack with its own Config,
+// package-level functions are using Pack with DefaultConfig
+type Pack struct {
+	cfg Config
+
+	// runtime state of servers of the pack
+	state *packState
+}
+
+// New returns Pack which uses given config, it has its own readiness, counters and TLS certificate
+// (see Pack methods), so several packs can run in one process. Zero value of a field is taken as is,
+// so cfg should be obtained from DefaultConfig and then changed: i.e. Config{} has no ShutdownSignals,
+// no restarts of worker processes and no delay between bind retries. Only nil Logger is replaced
+// with standard logger writing to stdout
+func New(cfg Config) *Pack {
+	return newPack(cfg, newPackState())
+}
+
+func newPack(cfg Config, state *packState) *Pack {
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(os.Stdout, logPrefix, log.LstdFlags)
+	}
+
+	return &Pack{
+		cfg:   cfg,
+		state: state,
+	}
+}
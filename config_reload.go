@@ -0,0 +1,77 @@
+package gopherpack
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+)
+
+// ErrUpgradeRequired can be returned by OnConfigReload (wrapped or as is) if new config can't be applied in place,
+// main process falls back to executable upgrade then as if it received one of ReloadSignals
+var ErrUpgradeRequired = errors.New("executable upgrade required")
+
+// reloadsConfig tells if pack handles ConfigReloadSignals
+func (p *Pack) reloadsConfig() bool {
+	return (p.cfg.OnConfigReload != nil || p.cfg.TLSCertFile != "") && len(p.cfg.ConfigReloadSignals) > 0
+}
+
+// handleConfigReloadSignals reloads TLSCertFile and calls OnConfigReload when worker process receives ConfigReloadSignals
+func (p *Pack) handleConfigReloadSignals() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, p.cfg.ConfigReloadSignals...)
+	for sig := range sigChan {
+		p.infof("Worker process PID=%d received signal: %s. Reloading config\n", pid, sig)
+		if p.reloadConfig() {
+			p.notifyMainProcess(msgUpgrade, "")
+		}
+	}
+}
+
+// reloadConfig reloads TLSCertFile, calls OnConfigReload hook and tells if executable upgrade is required
+// to apply new config, server keeps running with previous certificate and config if they can't be loaded
+func (p *Pack) reloadConfig() bool {
+	if err := p.loadTLSCertFile(); err != nil {
+		p.errorf("%s PID=%d could not reload TLS certificate, keep serving with previous one: %s\n",
+			p.processName(), pid, err)
+	}
+	if p.cfg.OnConfigReload == nil {
+		return false
+	}
+	reloadErr := errors.New("OnConfigReload hook panicked")
+	p.callHook("OnConfigReload", func() { reloadErr = p.cfg.OnConfigReload() })
+	switch {
+	case errors.Is(reloadErr, ErrUpgradeRequired):
+		p.infof("%s PID=%d config requires executable upgrade: %s\n", p.processName(), pid, reloadErr)
+		return true
+	case reloadErr != nil:
+		p.errorf("%s PID=%d could not reload config, keep serving with previous one: %s\n",
+			p.processName(), pid, reloadErr)
+	}
+
+	return false
+}
+
+// reloadConfig relays config reload signal to ready workers, workers which are not ready yet
+// do not handle it and read new config on start anyway
+func (s *supervisor) reloadConfig(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == nil || !w.ready {
+			continue
+		}
+		if err := w.process.Signal(sig); err != nil && err != os.ErrProcessDone {
+			s.warnf("Main process PID=%d could not send %s to worker process PID=%d: %s\n",
+				pid, sig, w.process.Pid, err)
+		}
+	}
+}
+
+// requestUpgrade asks main process to start executable upgrade, requests made while one is pending are merged
+func (s *supervisor) requestUpgrade(process *os.Process) {
+	s.infof("Main process PID=%d worker process PID=%d requested executable upgrade\n", pid, process.Pid)
+	select {
+	case s.upgradeRequests <- struct{}{}:
+	default:
+	}
+}
@@ -6,4 +6,55 @@ const (
 	envPPID     = envPrefix + "PPID"
 	envPrevPPID = envPrefix + "PREV_PPID"
 	envCPUCore  = envPrefix + "CPU_CORE"
+	envCPUSet   = envPrefix + "CPU_SET"
+
+	envControlFD      = envPrefix + "CONTROL_FD"
+	envListenerFD     = envPrefix + "LISTENER_FD"
+	envTLSTicketKeyFD = envPrefix + "TLS_TICKET_KEY_FD"
+)
+
+// isGopherpackEnvVar tells if env var name is one of env vars gopherpack passes to child processes,
+// other vars having the same prefix belong to the application
+func isGopherpackEnvVar(name string) bool {
+	switch name {
+	case envPPID, envPrevPPID, envCPUCore, envCPUSet, envControlFD, envListenerFD, envTLSTicketKeyFD:
+		return true
+	}
+
+	return false
+}
+
+// IPv6Binding controls whether IPv6 listening socket accepts IPv4 traffic too
+type IPv6Binding int
+
+const (
+	// IPv6Default leaves IPV6_V6ONLY as Go sets it: dual-stack for "tcp" and "udp", IPv6-only for "tcp6" and "udp6"
+	IPv6Default IPv6Binding = iota
+	// IPv6Only makes IPv6 listening socket to accept IPv6 traffic only
+	IPv6Only
+	// IPv6DualStack makes IPv6 listening socket to accept both IPv4 and IPv6 traffic
+	IPv6DualStack
+)
+
+// HandlerLimitAction controls what TCP server does with new connection when MaxConcurrentHandlers is reached
+type HandlerLimitAction int
+
+const (
+	// HandlerLimitBlock makes TCP server to wait until one of handlers is done before handling new connection,
+	// next connections are kept in listen backlog of the kernel meanwhile
+	HandlerLimitBlock HandlerLimitAction = iota
+	// HandlerLimitReject makes TCP server to close new connection right away
+	HandlerLimitReject
+)
+
+// ProxyProtocolMode controls whether accepted connections are expected to start with PROXY protocol header
+type ProxyProtocolMode int
+
+const (
+	// ProxyProtocolOff makes accepted connections to be used as is
+	ProxyProtocolOff ProxyProtocolMode = iota
+	// ProxyProtocolOptional makes PROXY protocol header to be parsed if connection starts with it
+	ProxyProtocolOptional
+	// ProxyProtocolRequired makes connections without valid PROXY protocol header to be closed
+	ProxyProtocolRequired
 )
@@ -0,0 +1,48 @@
+package gopherpack
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// workerContextKey is a key of worker process info in context of HTTP server
+type workerContextKey struct{}
+
+// workerInfo describes worker process which serves connection
+type workerInfo struct {
+	cpuCore int
+	pid     int
+}
+
+// CoreFromContext returns CPU core of worker process serving HTTP request with given context,
+// it is -1 if worker process is not placed on CPU core (primary one of its NUMA node is returned if NUMAAffinity is set), false is returned if context does not come from gopherpack
+func CoreFromContext(ctx context.Context) (int, bool) {
+	info, ok := ctx.Value(workerContextKey{}).(workerInfo)
+
+	return info.cpuCore, ok
+}
+
+// WorkerPIDFromContext returns PID of worker process serving HTTP request with given context,
+// false is returned if context does not come from gopherpack
+func WorkerPIDFromContext(ctx context.Context) (int, bool) {
+	info, ok := ctx.Value(workerContextKey{}).(workerInfo)
+
+	return info.pid, ok
+}
+
+// baseContext returns BaseContext for HTTP server which carries info of worker process
+func (p *Pack) baseContext(net.Listener) context.Context {
+	return context.WithValue(context.Background(), workerContextKey{}, workerInfo{cpuCore: p.cpuCore(), pid: pid})
+}
+
+// cpuCore returns CPU core worker process is placed on (primary one if it is placed on NUMA node),
+// -1 if it is not placed on CPU core
+func (p *Pack) cpuCore() int {
+	cpuCore, err := strconv.Atoi(workerCpuCore)
+	if err != nil || p.cfg.DisableAffinity {
+		return -1
+	}
+
+	return cpuCore
+}
@@ -0,0 +1,107 @@
+package gopherpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Each worker process gets its own control channel to send messages to main process (see newControlChannel),
+// so main process knows which worker process sent a message by the channel it came from.
+// Message is a frame of 4 bytes big-endian length followed by "<type> [payload]".
+const (
+	// worker process has its listener ready and starts serving
+	msgReady = "ready"
+	// worker process is alive, see Config.HeartbeatTimeout
+	msgHeartbeat = "heartbeat"
+	// worker process reported it is degraded (payload is the reason) or recovered, see ReportUnhealthy
+	msgUnhealthy = "unhealthy"
+	msgHealthy   = "healthy"
+	// worker process is going to exit gracefully to be replaced by new one, see Config.MaxRequests
+	msgRecycle = "recycle"
+	// worker process served MaxRequests requests and waits for main process to recycle it, see Config.MaxRequests
+	msgRequests = "requests"
+	// worker process reports number of connections it accepted so far, see Config.AcceptSkewInterval
+	msgAccepts = "accepts"
+	// worker process could not apply new config in place and asks for executable upgrade, see Config.OnConfigReload
+	msgUpgrade = "upgrade"
+	// worker process reports its resident memory in bytes, see Config.WorkerMaxMemory
+	msgMemory = "memory"
+	// worker process reports number of its goroutines and open file descriptors, see Config.ResourceReportInterval
+	msgResources = "resources"
+
+	// maxMsgLen limits length of message main process accepts, longer message means worker process is broken
+	maxMsgLen = 64 << 10
+)
+
+var controlPipe = inheritedFile(envControlFD, "gopherpack-control")
+
+// inheritedFile returns file passed by parent process, its descriptor is specified in env var
+func inheritedFile(envName string, fileName string) *os.File {
+	if os.Getenv(envName) == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(os.Getenv(envName))
+	if err != nil {
+		return nil
+	}
+
+	return os.NewFile(uintptr(fd), fileName)
+}
+
+// notifyMainProcess sends message to main process, does nothing if there is no control channel
+func (p *Pack) notifyMainProcess(msgType string, payload string) {
+	if controlPipe == nil {
+		return
+	}
+	if err := writeControlMessage(controlPipe, msgType, payload); err != nil {
+		p.warnf("Worker process PID=%d could not send message to main process: %s\n", pid, err)
+	}
+}
+
+// writeControlMessage writes message as a single frame, so messages sent by concurrent goroutines don't interleave
+func writeControlMessage(w io.Writer, msgType string, payload string) error {
+	msgLen := len(msgType) + 1 + len(payload)
+	if msgLen > maxMsgLen {
+		return fmt.Errorf("control message %s is %d bytes long, maximum is %d", msgType, msgLen, maxMsgLen)
+	}
+	frame := make([]byte, 4, 4+msgLen)
+	binary.BigEndian.PutUint32(frame, uint32(msgLen))
+	frame = append(frame, msgType...)
+	frame = append(frame, ' ')
+	frame = append(frame, payload...)
+	_, err := w.Write(frame)
+
+	return err
+}
+
+// readControlMessage reads message sent by worker process and returns its type and payload,
+// io.EOF is returned once worker process has closed its control channel
+func readControlMessage(r *bufio.Reader) (string, string, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", "", err
+	}
+	msgLen := binary.BigEndian.Uint32(header[:])
+	if msgLen > maxMsgLen {
+		return "", "", fmt.Errorf("control message is %d bytes long, maximum is %d", msgLen, maxMsgLen)
+	}
+	msg := make([]byte, msgLen)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", "", err
+	}
+	msgType, payload, found := strings.Cut(string(msg), " ")
+	if !found || msgType == "" {
+		return "", "", fmt.Errorf("malformed control message: %q", msg)
+	}
+
+	return msgType, payload, nil
+}
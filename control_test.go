@@ -0,0 +1,64 @@
+package gopherpack
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlMessageIsNotTruncated(t *testing.T) {
+	main, worker, err := newControlChannel()
+	if err != nil {
+		t.Fatalf("could not create control channel: %v", err)
+	}
+	defer main.Close()
+	reason := "database is down\n" + strings.Repeat("x", 1024)
+	go func() {
+		writeControlMessage(worker, msgUnhealthy, reason)
+		writeControlMessage(worker, msgReady, "")
+		worker.Close()
+	}()
+
+	r := bufio.NewReader(main)
+	msgType, payload, err := readControlMessage(r)
+	if err != nil || msgType != msgUnhealthy || payload != reason {
+		t.Fatalf("read %q %q %v, want unhealthy message with full reason", msgType, payload, err)
+	}
+	if msgType, payload, err = readControlMessage(r); err != nil || msgType != msgReady || payload != "" {
+		t.Fatalf("read %q %q %v, want ready message", msgType, payload, err)
+	}
+}
+
+func TestReadControlIdentifiesWorkerByChannel(t *testing.T) {
+	p := newSingleProcessPack(0)
+	workers := newSupervisor(p, 2, []int{0}, nil)
+	// processes are not started, worker is told apart by control channel and not by PID it reports
+	for i, w := range workers.workers {
+		w.process = &os.Process{Pid: 1000 + i}
+	}
+	main, worker, err := newControlChannel()
+	if err != nil {
+		t.Fatalf("could not create control channel: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		workers.readControl(workers.workers[1].process, main)
+		close(done)
+	}()
+	writeControlMessage(worker, msgUnhealthy, "1000")
+	worker.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("control channel is not read until worker process closes it")
+	}
+
+	if workers.workers[0].unhealthy {
+		t.Error("message is attributed to another worker process")
+	}
+	if !workers.workers[1].unhealthy || workers.workers[1].unhealthyReason != "1000" {
+		t.Error("message is not attributed to worker process owning control channel")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package gopherpack
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// newControlChannel returns connected ends of control channel of a worker process,
+// main process reads from first one and worker process inherits the second one
+func newControlChannel() (*os.File, *os.File, error) {
+	// worker process inherits its end via ExtraFiles only, ForkLock keeps other forks from inheriting it
+	// before close-on-exec is set (there is no SOCK_CLOEXEC on every platform)
+	syscall.ForkLock.RLock()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err == nil {
+		unix.CloseOnExec(fds[0])
+		unix.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return os.NewFile(uintptr(fds[0]), "gopherpack-control"), os.NewFile(uintptr(fds[1]), "gopherpack-control"), nil
+}
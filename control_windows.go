@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package gopherpack
+
+import "os"
+
+// newControlChannel returns connected ends of control channel of a worker process,
+// there are no unix socket pairs on Windows so a pipe is used (worker processes are not forked there anyway)
+func newControlChannel() (*os.File, *os.File, error) {
+	return os.Pipe()
+}
@@ -0,0 +1,79 @@
+package gopherpack
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/dencoded/gopherpack/system"
+)
+
+// DumpDiagnostics returns report about environment the pack runs in, i.e. to find out why it started
+// fewer worker processes than expected, it is logged by main process on start if LogDiagnostics is set
+func DumpDiagnostics() string {
+	return defaultPack().DumpDiagnostics()
+}
+
+// DumpDiagnostics returns report using config of the pack, see package-level DumpDiagnostics
+func (p *Pack) DumpDiagnostics() string {
+	var b strings.Builder
+	line := func(name string, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-20s "+format+"\n", append([]interface{}{name + ":"}, args...)...)
+	}
+
+	line("platform", "%s/%s, %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	line("prefork supported", "%t", preforkSupported)
+	line("CPUs", "%d", runtime.NumCPU())
+	cpus, err := system.AllowedCPUs()
+	if err != nil {
+		line("allowed CPUs", "unknown (%s)", err)
+	} else {
+		line("allowed CPUs", "%d %v", len(cpus), cpus)
+	}
+	quota, err := system.CPUQuota()
+	switch {
+	case err != nil:
+		line("CPU quota", "unknown (%s)", err)
+	case quota <= 0:
+		line("CPU quota", "none")
+	default:
+		line("CPU quota", "%.2f cores (ignored: %t)", quota, p.cfg.IgnoreCPUQuota)
+	}
+	if len(cpus) == 0 {
+		cpus = make([]int, runtime.NumCPU())
+	}
+	// worker count is computed the way main process does it but without logging CPU quota
+	numWorkers := p.cfg.WorkerCount
+	if numWorkers <= 0 {
+		numWorkers = len(cpus)
+		if err == nil && !p.cfg.IgnoreCPUQuota {
+			numWorkers = quotaWorkerCount(len(cpus), quota)
+		}
+	}
+	line("worker count", "%d (configured: %d, main process serves: %t)",
+		servingWorkerCount(numWorkers, p.cfg.MainAlsoServes), p.cfg.WorkerCount, p.cfg.MainAlsoServes)
+	if err := reusePortSupported(); err != nil {
+		line("SO_REUSEPORT", "not available (%s)", err)
+	} else {
+		line("SO_REUSEPORT", "available")
+	}
+	line("CPU affinity", "supported: %t, disabled: %t, NUMA: %t",
+		system.AffinitySupported, p.cfg.DisableAffinity, p.cfg.NUMAAffinity)
+	if p.cfg.ExecutablePath != "" {
+		line("worker executable", "%s (configured)", p.cfg.ExecutablePath)
+		line("upgrade executable", "%s (configured)", p.cfg.ExecutablePath)
+	} else {
+		if path, err := workerExecutable(); err != nil {
+			line("worker executable", "unknown (%s)", err)
+		} else {
+			line("worker executable", "%s", path)
+		}
+		if path, err := p.upgradeExecutable(); err != nil {
+			line("upgrade executable", "unknown (%s)", err)
+		} else {
+			line("upgrade executable", "%s", path)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,21 @@
+package gopherpack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDumpDiagnosticsReportsConfiguredExecutable(t *testing.T) {
+	p, logged := newLoggedPack()
+	p.cfg.ExecutablePath = "/usr/local/bin/server"
+	p.cfg.WorkerCount = 0
+	report := p.DumpDiagnostics()
+
+	if !strings.Contains(report, "worker executable:   /usr/local/bin/server") ||
+		!strings.Contains(report, "upgrade executable:  /usr/local/bin/server") {
+		t.Errorf("report does not contain configured executable:\n%s", report)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("unexpected log output: %q", logged.String())
+	}
+}
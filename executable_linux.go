@@ -0,0 +1,36 @@
+package gopherpack
+
+import (
+	"os"
+	"strings"
+)
+
+// procSelfExe always refers to executable file (inode) current process is running
+const procSelfExe = "/proc/self/exe"
+
+// workerExecutable returns path to executable to start worker process with.
+// Worker processes must run the same code as main process so /proc/self/exe is used,
+// it keeps pointing to the running executable even if file on disk was replaced or removed
+func workerExecutable() (string, error) {
+	return procSelfExe, nil
+}
+
+// upgradeExecutable returns path to executable to start new main process with during executable upgrade.
+// Deploy tools usually replace executable via atomic rename of new file over the old path, then running
+// executable has no name anymore and kernel reports its previous path with " (deleted)" suffix,
+// so the path is re-resolved and new executable at the same path is picked up. If nothing is at that path
+// (i.e. executable was removed before new one is copied), running executable is started again via /proc/self/exe
+func (p *Pack) upgradeExecutable() (string, error) {
+	path, err := os.Readlink(procSelfExe)
+	if err != nil {
+		return "", err
+	}
+	path = strings.TrimSuffix(path, " (deleted)")
+	if _, err := os.Stat(path); err != nil {
+		p.warnf("Main process PID=%d executable %s is missing (%s), restarting running executable instead\n",
+			pid, path, err)
+		return procSelfExe, nil
+	}
+
+	return path, nil
+}
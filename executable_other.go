@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package gopherpack
+
+import (
+	"os"
+	"os/exec"
+)
+
+// workerExecutable returns path to executable to start worker process with
+func workerExecutable() (string, error) {
+	return exec.LookPath(os.Args[0])
+}
+
+// upgradeExecutable returns path to executable to start new main process with during executable upgrade
+func (p *Pack) upgradeExecutable() (string, error) {
+	return exec.LookPath(os.Args[0])
+}
@@ -4,11 +4,15 @@ Package gopherpack provides functionality to run network services written in Go
 package gopherpack
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"sync"
 	"syscall"
@@ -18,132 +22,374 @@ import (
 )
 
 const (
-	// this is how long new main process will wait before killing the previous main process
-	prevMainProcessGraceInterval = 5 * time.Second
-
 	logPrefix = "gopherpack: "
 )
 
+// Package-level settings used by package-level functions, see Config for their description
 var (
-	// OnSIGUSR2 is called in main process before starting executable upgrade process
-	OnSIGUSR2 func()
+	OnSIGUSR2               func()
+	OnUpgrade               func() error
+	OnWorkersStarted        func(pids []int)
+	OnServerShutdown        func()
+	OnWorkerStart           func(cpuCore int)
+	OnWorkerForked          func(pid int, cpuCore int)
+	OnWorkerExited          func(pid int, state *os.ProcessState)
+	OnConnectionAccepted    func(remote net.Addr)
+	OnUpgradeResult         func(newPID int, err error)
+	SocketControl           func(fd uintptr) error
+	ExtraWorkerEnv          func(workerIndex int) []string
+	OnMainShutdown          func()
+	OnHeartbeat             func() error
+	OnColdStart             func()
+	OnReload                func(prevPID int)
+	ConnFilter              func(conn net.Conn) bool
+	OnPackReady             func(err error)
+	OnServerShutdownContext func(ctx context.Context)
+	OnConfigReload          func() error
+	OnAcceptError           func(err error) (retry bool)
 
-	// OnServerShutdown is called in worker process before doing graceful server shutdown
-	OnServerShutdown func()
+	WorkerCount            int
+	MaxRestarts            = 10
+	RestartBackoff         = time.Second
+	UpgradeGraceInterval   = 5 * time.Second
+	ShutdownTimeout        time.Duration
+	DisableAffinity        bool
+	SharedListener         bool
+	ReloadSignals          = []os.Signal{sigUpgrade}
+	ShutdownSignals        = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+	SingleProcess          bool
+	StrictReusePort        bool
+	IPv6Mode               IPv6Binding
+	RemoveStaleUnixSocket  bool
+	UnixSocketMode         os.FileMode
+	PreShutdownDelay       time.Duration
+	HealthChecks           bool
+	MinWorkers             int
+	ExecutablePath         string
+	ExecutableArgs         []string
+	MaxConcurrentHandlers  int
+	HandlerLimitPolicy     HandlerLimitAction
+	H2C                    bool
+	TCPKeepAlive           time.Duration
+	TCPLinger              int
+	TCPReadTimeout         time.Duration
+	TCPWriteTimeout        time.Duration
+	ListenConfig           *net.ListenConfig
+	HeartbeatTimeout       time.Duration
+	ForceKillTimeout       time.Duration
+	LogConnections         bool
+	WorkerUID              int
+	WorkerGID              int
+	WorkerSysProcAttr      *syscall.SysProcAttr
+	ParentDeathSignal      = syscall.SIGTERM
+	TLSHandshakeTimeout    time.Duration
+	WorkerGOMAXPROCS       = 1
+	NUMAAffinity           bool
+	IgnoreCPUQuota         bool
+	DrainSignals           = []os.Signal{sigDrain}
+	UndrainSignals         []os.Signal
+	ProxyProtocol          ProxyProtocolMode
+	CountBytes             bool
+	UpgradeRetries         int
+	UpgradeRetryBackoff    = 10 * time.Second
+	PIDFile                string
+	ShareTLSSessionTickets bool
+	WorkerMaxLifetime      time.Duration
+	MaxRequests            int
+	SendBufferSize         int
+	RecvBufferSize         int
+	TCPNoDelay             = true
+	AcceptSkewInterval     time.Duration
+	AcceptSkewThreshold    = 2.0
+	BindRetries            int
+	BindRetryInterval      = 100 * time.Millisecond
+	MainAlsoServes         bool
+	PackReadyTimeout       = 30 * time.Second
+	ConfigReloadSignals    = []os.Signal{sigConfigReload}
+	TLSCertFile            string
+	TLSKeyFile             string
+	LogDiagnostics         bool
+	BindToDevice           string
+	WorkerMaxMemory        int64
+	MemoryCheckInterval    = 5 * time.Second
+	ResourceReportInterval time.Duration
+	ForkStagger            time.Duration
 
-	// Logger can be set to client's logging which should implements StdLogger,
-	// default is Go's standard logger with output to stdout
-	Logger StdLogger = log.New(os.Stdout, logPrefix, log.LstdFlags)
+	Logger           StdLogger = log.New(os.Stdout, logPrefix, log.LstdFlags)
+	StructuredLogger LeveledLogger
+)
+
+// errors returned by the pack, they wrap underlying errors (if any) so they can be checked with errors.Is
+var (
+	// ErrMainProcessStopped is returned by main process after StopMainProcess was called
+	ErrMainProcessStopped = errors.New("main process stopped")
+	// ErrNoWorkersStarted is returned by main process if it could not start MinWorkers worker processes
+	ErrNoWorkersStarted = errors.New("not enough worker processes started")
+	// ErrAffinityDenied is joined with error of main process if kernel denied to set CPU affinity
+	// of worker process, such worker process keeps running without being pinned
+	ErrAffinityDenied = errors.New("CPU affinity denied")
+	// ErrBindFailed is returned if listener could not be bound to address
+	ErrBindFailed = errors.New("could not bind address")
+	// ErrPackNotReady is passed to OnPackReady if not all worker processes got ready within PackReadyTimeout
+	ErrPackNotReady = errors.New("not all worker processes are ready")
+)
+
+// main processes running in current process, see StopMainProcess
+var (
+	runningMainsMu sync.Mutex
+	runningMains   = map[*supervisor]struct{}{}
 )
 
 var (
 	pid           = os.Getpid()
-	isMainProcess = os.Getenv(envPPID) == ""
+	isMainProcess = preforkSupported && os.Getenv(envPPID) == ""
 	workerCpuCore = os.Getenv(envCPUCore)
+	// CPU cores of NUMA node worker process is placed on (see Config.NUMAAffinity)
+	workerCPUSet = os.Getenv(envCPUSet)
 )
 
 // IsMainProcess returns true if current process is not a worker
+// (false if package-level SingleProcess is set)
 func IsMainProcess() bool {
-	return isMainProcess
+	return isMainProcess && !SingleProcess
+}
+
+// IsUpgradedMainProcess returns true if current process is main process started by previous main process
+// during executable upgrade (as opposed to cold start)
+func IsUpgradedMainProcess() bool {
+	return IsMainProcess() && os.Getenv(envPrevPPID) != ""
+}
+
+// isMainProcess returns true if current process is main process of the pack
+func (p *Pack) isMainProcess() bool {
+	return isMainProcess && !p.cfg.SingleProcess
 }
 
 // GetWorkerCPUCoreNum returns number of CPU core currently used if it is a worker process
 func GetWorkerCPUCoreNum() string {
-	if isMainProcess {
+	if IsMainProcess() {
 		return "main process"
 	}
 
 	return workerCpuCore
 }
 
-// StartMainProcess starts main process and forks worker processes
+// StartMainProcess starts main process and forks worker processes, returned error tells why main process exited
+// and is joined with errors of worker processes which could not be forked or restarted or pinned to CPU core (if any),
+// see ErrNoWorkersStarted and ErrAffinityDenied
 func StartMainProcess() error {
-	Logger.Printf("Main process PID=%d, starting up a pack..\n", pid)
-	// run worker processes, one per each CPU core
-	numCPU := runtime.NumCPU()
-	workers := make([]*os.Process, numCPU)
-	var err error
-	for i := 0; i < numCPU; i++ {
-		// these env vars will make process to start worker part
-		envVals := []string{
-			fmt.Sprintf("%s=%d", envPPID, pid),  // to tell child that it is child
-			fmt.Sprintf("%s=%d", envCPUCore, i), // to tell child on which core it was placed
-		}
-		// set affinity of main process on the fly so forked worker process will inherit it
-		if err = system.SetAffinity(i); err != nil {
-			Logger.Printf("Could not set affinity to CPU core %d: %s\n", i, err)
+	return defaultPack().StartMainProcess()
+}
+
+// StartMainProcessContext is the same as StartMainProcess but shutdown also starts when ctx is done
+func StartMainProcessContext(ctx context.Context) error {
+	return defaultPack().StartMainProcessContext(ctx)
+}
+
+// StartMainProcess starts main process using config of the pack, see package-level StartMainProcess
+func (p *Pack) StartMainProcess() error {
+	return p.StartMainProcessContext(context.Background())
+}
+
+// StartMainProcessContext starts main process using config of the pack, see package-level StartMainProcessContext
+func (p *Pack) StartMainProcessContext(ctx context.Context) error {
+	return p.startMainProcess(ctx, nil, nil)
+}
+
+// StopMainProcess makes main processes running in current process to shutdown gracefully as if shutdown signal was received,
+// it does not wait for shutdown to complete, StartMainProcess returns ErrMainProcessStopped once worker processes are done.
+// It does nothing if no main process is running, main processes started afterwards run as usual
+func StopMainProcess() {
+	runningMainsMu.Lock()
+	defer runningMainsMu.Unlock()
+	for workers := range runningMains {
+		workers.requestStop()
+	}
+}
+
+// StopMainProcess makes running main process of the pack to shutdown gracefully, see package-level StopMainProcess
+func (p *Pack) StopMainProcess() {
+	if workers := p.state.runningSupervisor(); workers != nil {
+		workers.requestStop()
+	}
+}
+
+// registerMain makes StopMainProcess to stop main process controlling workers until it is unregistered
+func registerMain(workers *supervisor) {
+	runningMainsMu.Lock()
+	runningMains[workers] = struct{}{}
+	runningMainsMu.Unlock()
+}
+
+func unregisterMain(workers *supervisor) {
+	runningMainsMu.Lock()
+	delete(runningMains, workers)
+	runningMainsMu.Unlock()
+}
+
+// startMainProcess runs main process, listenerFile is a listener to be shared with workers (can be nil),
+// serve is a server of main process if MainAlsoServes is set (can be nil)
+func (p *Pack) startMainProcess(ctx context.Context, listenerFile *os.File, serve mainServeFunc) error {
+	_, err := p.runMainProcess(ctx, listenerFile, serve)
+
+	return err
+}
+
+// runMainProcess runs main process as startMainProcess does and also tells how it exited
+func (p *Pack) runMainProcess(ctx context.Context, listenerFile *os.File, serve mainServeFunc) (ExitInfo, error) {
+	if !preforkSupported {
+		return ExitInfo{}, errors.New("main process is not supported on this platform")
+	}
+
+	p.infof("Main process PID=%d, starting up a pack..\n", pid)
+	if p.cfg.LogDiagnostics {
+		p.infof("Main process PID=%d diagnostics:\n%s", pid, p.DumpDiagnostics())
+	}
+	// call a hook if needed
+	if prevMainPIDStr := os.Getenv(envPrevPPID); prevMainPIDStr == "" {
+		if p.cfg.OnColdStart != nil {
+			p.callHook("OnColdStart", p.cfg.OnColdStart)
 		}
-		// fork main process to start worker
-		if workers[i], err = forkProcess(envVals); err != nil {
-			Logger.Printf("Could not start worker process. Error: %s\n", err)
-		} else {
-			Logger.Printf("Worker process PID=%d started on CPU core %d\n", workers[i].Pid, i)
+	} else if p.cfg.OnReload != nil {
+		prevMainPID, _ := strconv.Atoi(prevMainPIDStr)
+		p.callHook("OnReload", func() { p.cfg.OnReload(prevMainPID) })
+	}
+	// new main process rewrites PID file only after taking over from previous main process
+	if p.cfg.PIDFile != "" {
+		if os.Getenv(envPrevPPID) == "" {
+			if err := p.writePIDFile(); err != nil {
+				return ExitInfo{}, fmt.Errorf("could not write PID file: %w", err)
+			}
 		}
+		defer p.removePIDFile()
+	}
+	// run worker processes, by default one per each CPU core process is allowed to use
+	cpus := p.allowedCPUs()
+	numWorkers := p.workerCount(cpus, serve != nil)
+	// signals received while worker processes are forked are handled once all of them are started
+	sigChan := make(chan os.Signal, 1)
+	// empty set of signals would make all incoming signals to be relayed
+	if len(p.cfg.ShutdownSignals) > 0 {
+		signal.Notify(sigChan, p.cfg.ShutdownSignals...) // graceful shutdown
+	}
+	if len(p.cfg.ReloadSignals) > 0 {
+		signal.Notify(sigChan, p.cfg.ReloadSignals...) // upgrade executable
+	}
+	if p.reloadsConfig() {
+		signal.Notify(sigChan, p.cfg.ConfigReloadSignals...) // reload config in place
+	}
+	defer signal.Stop(sigChan)
+	workers := newSupervisor(p, numWorkers, cpus, listenerFile)
+	p.state.setRunningSupervisor(workers)
+	defer p.state.setRunningSupervisor(nil)
+	registerMain(workers)
+	defer unregisterMain(workers)
+	started := workers.start()
+	// there is no point to wait for signals if pack can't serve
+	minWorkers := p.cfg.MinWorkers
+	if minWorkers <= 0 {
+		minWorkers = 1
+	}
+	if minWorkers > numWorkers {
+		minWorkers = numWorkers
+	}
+	if started < minWorkers {
+		p.errorf("Main process PID=%d started %d of %d worker processes, required minimum is %d\n",
+			pid, started, numWorkers, minWorkers)
+		p.stopWorkers(workers, p.shutdownSignal())
+		return workers.exitInfo(nil, false), withForkErrors(
+			fmt.Errorf("%w: started %d of %d worker processes, required minimum is %d",
+				ErrNoWorkersStarted, started, numWorkers, minWorkers),
+			workers,
+		)
+	}
+	// nobody else reaps orphaned processes if we are init process of a container
+	if pid == 1 {
+		go workers.reapOrphans()
+	}
+	if p.cfg.OnWorkersStarted != nil {
+		pids := workers.pids()
+		p.callHook("OnWorkersStarted", func() { p.cfg.OnWorkersStarted(pids) })
+	}
+
+	// serve along with workers, server of main process stops on shutdown signal as servers of worker processes do
+	// and once main process is about to exit
+	if serve != nil {
+		serveCtx, stopServing := context.WithCancel(ctx)
+		serveDone := p.serveInMainProcess(serveCtx, serve, listenerFile)
+		defer func() {
+			stopServing()
+			<-serveDone
+		}()
+	}
+
+	if p.cfg.OnPackReady != nil {
+		go p.waitPackReady(workers)
 	}
 
 	// terminate previos main process if needed (executable upgraded)
+	upgradeAborted := make(chan struct{})
 	if prevMainPIDStr := os.Getenv(envPrevPPID); prevMainPIDStr != "" {
-		go func() {
-			// let new main process and previous main process co-exist for some time
-			time.Sleep(prevMainProcessGraceInterval)
-			// send SIGTERM to previous main process
-			prevMainPID, err := strconv.Atoi(prevMainPIDStr)
-			if err != nil {
-				Logger.Printf("Main process PID=%d could not parse previous PID: %s\n",
-					pid, err)
-			} else if prevProcess, err := os.FindProcess(prevMainPID); err != nil {
-				Logger.Printf("Main process PID=%d could not find process for previous PID=%d: %s\n",
-					pid, prevMainPID, err)
-			} else if err := prevProcess.Signal(syscall.SIGTERM); err != nil {
-				Logger.Printf("Main process PID=%d could not send SIGTERM to previous PID=%d: %s\n",
-					pid, prevMainPID, err)
-			}
-		}()
+		go p.takeOver(workers, prevMainPIDStr, upgradeAborted)
 	}
 
 	// wait for signals to main process
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(
-		sigChan,
-		syscall.SIGINT,  // graceful shutdown
-		syscall.SIGTERM, // graceful shutdown
-		syscall.SIGQUIT, // graceful shutdown
-		syscall.SIGUSR2, // upgrade executable
-	)
+	upgrade := newUpgradeState()
 	var sig os.Signal
 	for {
 		isExit := false
-		sig = <-sigChan
-		Logger.Printf("Main process PID=%d recivied signal: %s\n", pid, sig)
-		switch sig {
-		case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT: // graceful shutdown:
+		select {
+		case sig = <-sigChan:
+		case <-ctx.Done():
+			p.infof("Main process PID=%d context is done: %s\n", pid, ctx.Err())
+			// propagate graceful shutdown to workers and wait until they are done
+			p.stopWorkers(workers, p.shutdownSignal())
+			return workers.exitInfo(nil, true), withForkErrors(fmt.Errorf("context done: %w", ctx.Err()), workers)
+		case <-workers.stopRequests:
+			err := p.stopMainProcess(workers)
+			return workers.exitInfo(nil, true), withForkErrors(err, workers)
+		case exit := <-upgrade.exited:
+			p.upgradeFailed(upgrade, exit)
+			continue
+		case <-upgrade.retry:
+			p.startUpgrade(upgrade, listenerFile)
+			continue
+		case <-workers.upgradeRequests:
+			// new config can't be applied without restarting workers
+			if !upgrade.inProgress {
+				upgrade.failures = 0
+				p.startUpgrade(upgrade, listenerFile)
+			}
+			continue
+		case <-upgradeAborted:
+			// previous main process keeps serving, so we are not needed
+			p.stopWorkers(workers, p.shutdownSignal())
+			return workers.exitInfo(nil, false), withForkErrors(fmt.Errorf("workers are not ready after %s, executable upgrade aborted",
+				p.cfg.UpgradeGraceInterval), workers)
+		}
+		p.infof("Main process PID=%d recivied signal: %s\n", pid, sig)
+		switch {
+		case containsSignal(p.cfg.ShutdownSignals, sig): // graceful shutdown:
 			// propagate signal to workers and wait until they are done
-			sendSignalToWorkers(workers, sig)
+			p.stopWorkers(workers, sig)
 			isExit = true
-		case syscall.SIGUSR2: // upgrade executable
-			// call a hook if needed
-			if OnSIGUSR2 != nil {
-				func() {
-					defer func() {
-						panicErr := recover()
-						Logger.Printf("Main process PID=%d OnSIGUSR2 hook panicked: %s", pid, panicErr)
-					}()
-					OnSIGUSR2()
-				}()
+		case containsSignal(p.cfg.ReloadSignals, sig): // upgrade executable
+			if upgrade.inProgress {
+				p.warnf("Main process PID=%d executable upgrade is already in progress\n", pid)
+				continue
 			}
-			Logger.Printf("Main process PID=%d starting new main process\n", pid)
-			// send current main process PID via env var so new main process will know
-			// which process to kill after successful start
-			envValues := []string{
-				fmt.Sprintf("%s=%d", envPrevPPID, pid),
-			}
-			if newMainProcess, err := forkProcess(envValues); err != nil {
-				Logger.Printf("Main process PID=%d could not start new main process: %s\n",
-					pid, err)
-			} else {
-				Logger.Printf("Main process PID=%d new main process PID=%d has started\n",
-					pid, newMainProcess.Pid)
+			upgrade.failures = 0
+			p.startUpgrade(upgrade, listenerFile)
+		case p.reloadsConfig() && containsSignal(p.cfg.ConfigReloadSignals, sig): // reload config in place
+			// server of main process reloads its config too
+			if p.cfg.MainAlsoServes && p.reloadConfig() {
+				if !upgrade.inProgress {
+					upgrade.failures = 0
+					p.startUpgrade(upgrade, listenerFile)
+				}
+				continue
 			}
+			workers.reloadConfig(sig)
 		}
 		if isExit {
 			break
@@ -151,64 +397,267 @@ func StartMainProcess() error {
 	}
 
 	// time for alpha gopher to exit
-	return fmt.Errorf("signal received: %s", sig)
+	return workers.exitInfo(sig, true), withForkErrors(fmt.Errorf("signal received: %s", sig), workers)
 }
 
-func sendSignalToWorkers(workers []*os.Process, sig os.Signal) {
-	var wg sync.WaitGroup
-	for _, worker := range workers {
-		if worker == nil {
-			continue
+// withForkErrors joins exit error of main process with errors of worker processes which could not be forked,
+// so callers can detect that pack was running partially
+func withForkErrors(err error, workers *supervisor) error {
+	forkErr := workers.forkErrors()
+	if forkErr == nil {
+		return err
+	}
+
+	return errors.Join(err, forkErr)
+}
+
+// allowedCPUs returns CPU cores main process is allowed to run on (i.e. limited by cpuset of container)
+func (p *Pack) allowedCPUs() []int {
+	cpus, err := system.AllowedCPUs()
+	if err == nil && len(cpus) > 0 {
+		return cpus
+	}
+	p.warnf("Main process PID=%d could not get allowed CPU cores, using all of them: %s\n", pid, err)
+	cpus = make([]int, runtime.NumCPU())
+	for i := range cpus {
+		cpus[i] = i
+	}
+
+	return cpus
+}
+
+// workerCount returns number of worker processes to start on cpus, mainServes tells if main process serves too
+func (p *Pack) workerCount(cpus []int, mainServes bool) int {
+	numWorkers := p.cfg.WorkerCount
+	if numWorkers <= 0 {
+		numWorkers = p.defaultWorkerCount(len(cpus))
+	}
+
+	return servingWorkerCount(numWorkers, mainServes)
+}
+
+// servingWorkerCount returns number of worker processes to fork,
+// main process takes place of one worker process if it serves too
+func servingWorkerCount(numWorkers int, mainServes bool) int {
+	if mainServes && numWorkers > 1 {
+		numWorkers--
+	}
+
+	return numWorkers
+}
+
+// defaultWorkerCount returns number of worker processes to start if WorkerCount is not set,
+// it is number of allowed CPU cores limited by CPU quota of cgroup (rounded down, at least one)
+func (p *Pack) defaultWorkerCount(numCPU int) int {
+	if p.cfg.IgnoreCPUQuota {
+		return numCPU
+	}
+	quota, err := system.CPUQuota()
+	if err != nil {
+		p.warnf("Main process PID=%d could not read CPU quota: %s\n", pid, err)
+		return numCPU
+	}
+	numWorkers := quotaWorkerCount(numCPU, quota)
+	if numWorkers == numCPU {
+		return numCPU
+	}
+	p.infof("Main process PID=%d CPU quota is %.2f cores, starting %d worker processes\n", pid, quota, numWorkers)
+
+	return numWorkers
+}
+
+// quotaWorkerCount returns number of allowed CPU cores limited by CPU quota (rounded down, at least one)
+func quotaWorkerCount(numCPU int, quota float64) int {
+	if quota <= 0 || int(quota) >= numCPU {
+		return numCPU
+	}
+	if int(quota) < 1 {
+		return 1
+	}
+
+	return int(quota)
+}
+
+// stopWorkers propagates signal to workers, waits until they are done and runs main process cleanup
+func (p *Pack) stopWorkers(workers *supervisor, sig os.Signal) {
+	workers.stop(sig)
+	if p.cfg.OnMainShutdown != nil {
+		p.callHook("OnMainShutdown", p.cfg.OnMainShutdown)
+	}
+}
+
+// stopMainProcess propagates graceful shutdown to workers and waits until they are done
+func (p *Pack) stopMainProcess(workers *supervisor) error {
+	p.infof("Main process PID=%d stop requested\n", pid)
+	p.stopWorkers(workers, p.shutdownSignal())
+
+	return ErrMainProcessStopped
+}
+
+// shutdownSignal returns signal to send to worker processes to make them shutdown gracefully
+func (p *Pack) shutdownSignal() os.Signal {
+	if len(p.cfg.ShutdownSignals) > 0 {
+		return p.cfg.ShutdownSignals[0]
+	}
+
+	return syscall.SIGTERM
+}
+
+// containsSignal returns true if sig is one of signals
+func containsSignal(signals []os.Signal, sig os.Signal) bool {
+	for _, s := range signals {
+		if s == sig {
+			return true
 		}
-		wg.Add(1)
-		go func(p *os.Process) {
-			defer wg.Done()
-			if err := p.Signal(sig); err != nil {
-				Logger.Printf("Could not send signal %s to worker process PID=%d. Error: %s\n",
-					sig,
-					p.Pid,
-					err,
-				)
-			} else if pState, err := p.Wait(); err != nil {
-				Logger.Printf("Waiting failed after sending signal %s to worker process PID=%d. Error: %s\n",
-					sig,
-					p.Pid,
-					err,
-				)
-			} else {
-				Logger.Printf("Worker process PID=%d exited with status: %s\n",
-					p.Pid,
-					pState,
-				)
-			}
-		}(worker)
 	}
-	wg.Wait()
+
+	return false
+}
+
+// callHook calls user supplied hook and recovers if hook panics
+func (p *Pack) callHook(name string, hook func()) {
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			p.errorf("%s PID=%d %s hook panicked: %s\n%s", p.processName(), pid, name, panicErr, debug.Stack())
+		}
+	}()
+	hook()
+}
+
+// processName returns name of current process for logging
+func (p *Pack) processName() string {
+	if p.isMainProcess() {
+		return "Main process"
+	}
+
+	return "Worker process"
 }
 
-func setupWorkerRuntime() error {
-	Logger.Printf("Starting worker PID=%d on CPU core %s\n", pid, workerCpuCore)
+func (p *Pack) setupWorkerRuntime() error {
+	if workerCPUSet != "" {
+		p.infof("Starting worker PID=%d on CPU core %s of CPU cores %s\n", pid, workerCpuCore, workerCPUSet)
+	} else {
+		p.infof("Starting worker PID=%d on CPU core %s\n", pid, workerCpuCore)
+	}
 
-	// tell runtime to use system thread
-	runtime.GOMAXPROCS(1)
+	// tell runtime to use system thread (or WorkerGOMAXPROCS threads), server running as a single process
+	// and worker process not placed on CPU core keep using all CPU cores
+	if preforkSupported && !p.cfg.DisableAffinity && !p.cfg.SingleProcess && p.cfg.WorkerGOMAXPROCS >= 0 {
+		maxProcs := p.cfg.WorkerGOMAXPROCS
+		if maxProcs == 0 {
+			maxProcs = 1
+		}
+		runtime.GOMAXPROCS(maxProcs)
+	}
 
 	// set maximum number of file descriptors for our child process
-	var rLimit syscall.Rlimit
-	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+	prevLimit, limit, err := system.RaiseFileLimit()
+	if err != nil {
 		return err
 	}
-	Logger.Printf("Worker process PID=%d current number of file descriptors: %d\n",
+	p.debugf("Worker process PID=%d current number of file descriptors: %d\n",
 		pid,
-		rLimit.Cur,
+		prevLimit,
 	)
-	rLimit.Cur = rLimit.Max
-	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
-		return err
-	}
-	Logger.Printf("Worker process PID=%d current number of file descriptors set to maximum: %d\n",
+	p.debugf("Worker process PID=%d current number of file descriptors set to maximum: %d\n",
 		pid,
-		rLimit.Max,
+		limit,
 	)
 
+	// load TLS certificate which is reloaded on ConfigReloadSignals
+	if err := p.loadTLSCertFile(); err != nil {
+		return err
+	}
+
+	// call a hook if needed
+	if p.cfg.OnWorkerStart != nil {
+		cpuCore := p.cpuCore()
+		p.callHook("OnWorkerStart", func() { p.cfg.OnWorkerStart(cpuCore) })
+	}
+
 	return nil
 }
+
+// recycle makes all servers of worker process to shutdown gracefully and tells main process
+// to start replacement right away
+func (p *Pack) recycle() {
+	p.state.recycleOnce.Do(func() {
+		p.notifyMainProcess(msgRecycle, "")
+		close(p.state.recycleChan)
+	})
+}
+
+// serverShutdown tells server of worker process that graceful shutdown has started
+type serverShutdown struct {
+	// closed once shutdown hooks are called and PreShutdownDelay elapsed
+	started chan struct{}
+	// done once shutdown budget is spent (see ShutdownTimeout), it is set before started is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// watchShutdown waits for shutdown of worker process in background, see waitForShutdown
+func (p *Pack) watchShutdown(ctx context.Context) *serverShutdown {
+	shutdown := &serverShutdown{started: make(chan struct{})}
+	go func() {
+		// wait for signals to worker process
+		shutdown.ctx, shutdown.cancel = p.waitForShutdown(ctx)
+		close(shutdown.started)
+	}()
+
+	return shutdown
+}
+
+// release frees resources of shutdown context once server is done
+func (s *serverShutdown) release() {
+	select {
+	case <-s.started:
+		s.cancel()
+	default:
+	}
+}
+
+// shutdownContext returns context which is done once shutdown budget is spent, budget of PreShutdownDelay
+// plus ShutdownTimeout starts when shutdown starts, so time taken by shutdown hooks is counted too
+func (p *Pack) shutdownContext() (context.Context, context.CancelFunc) {
+	if p.cfg.ShutdownTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), p.cfg.PreShutdownDelay+p.cfg.ShutdownTimeout)
+}
+
+// waitForShutdown blocks until worker process receives a signal to shutdown gracefully, is recycled or ctx is done,
+// returned context is done once shutdown budget is spent
+func (p *Pack) waitForShutdown(ctx context.Context) (context.Context, context.CancelFunc) {
+	sigChan := make(chan os.Signal, 1)
+	if len(p.cfg.ShutdownSignals) > 0 {
+		signal.Notify(sigChan, p.cfg.ShutdownSignals...)
+	}
+	defer signal.Stop(sigChan)
+	select {
+	case sig := <-sigChan:
+		p.infof("%s PID=%d received signal: %s. Shutdown gracefully\n", p.processName(), pid, sig)
+	case <-p.state.recycleChan:
+		p.infof("Worker process PID=%d is recycled. Shutdown gracefully\n", pid)
+	case <-ctx.Done():
+		p.infof("%s PID=%d context is done: %s. Shutdown gracefully\n", p.processName(), pid, ctx.Err())
+	}
+	shutdownCtx, cancel := p.shutdownContext()
+	// make health checks to fail while we are draining
+	p.state.setReady(false)
+	// check if we need to run custom logic before calling shutdown
+	if p.cfg.OnServerShutdown != nil {
+		p.callHook("OnServerShutdown", p.cfg.OnServerShutdown)
+	}
+	if p.cfg.OnServerShutdownContext != nil {
+		p.callHook("OnServerShutdownContext", func() { p.cfg.OnServerShutdownContext(shutdownCtx) })
+	}
+	// let load balancers to route traffic away before we stop accepting connections
+	if p.cfg.PreShutdownDelay > 0 {
+		p.infof("%s PID=%d waiting %s before shutdown\n", p.processName(), pid, p.cfg.PreShutdownDelay)
+		time.Sleep(p.cfg.PreShutdownDelay)
+	}
+
+	return shutdownCtx, cancel
+}
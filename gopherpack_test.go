@@ -0,0 +1,40 @@
+package gopherpack
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// newLoggedPack returns Pack which logs to returned buffer
+func newLoggedPack() (*Pack, *bytes.Buffer) {
+	logged := &bytes.Buffer{}
+	cfg := DefaultConfig()
+	cfg.Logger = log.New(logged, "", 0)
+	cfg.StructuredLogger = nil
+
+	return New(cfg), logged
+}
+
+func TestCallHookLogsNothingWithoutPanic(t *testing.T) {
+	p, logged := newLoggedPack()
+	called := false
+	p.callHook("OnServerShutdown", func() { called = true })
+
+	if !called {
+		t.Error("hook is not called")
+	}
+	if logged.Len() != 0 {
+		t.Errorf("unexpected log output: %q", logged.String())
+	}
+}
+
+func TestCallHookLogsPanic(t *testing.T) {
+	p, logged := newLoggedPack()
+	p.callHook("OnServerShutdown", func() { panic("boom") })
+
+	if !strings.Contains(logged.String(), "OnServerShutdown hook panicked: boom") {
+		t.Errorf("panic is not logged: %q", logged.String())
+	}
+}
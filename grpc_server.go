@@ -1,11 +1,9 @@
 package gopherpack
 
 import (
+	"context"
 	"errors"
 	"net"
-	"os"
-	"os/signal"
-	"syscall"
 )
 
 // GRPCServer specifies interface which gRPC server should implement to be controlled by gopherpack
@@ -15,13 +13,40 @@ type GRPCServer interface {
 	GracefulStop()
 }
 
+// GRPCForceStopper can be optionally implemented by gRPC server to be force stopped
+// if graceful stop takes longer than ShutdownTimeout
+// (https://godoc.org/google.golang.org/grpc#Server implements this interface)
+type GRPCForceStopper interface {
+	Stop()
+}
+
 // ListenAndServeGRPC starts gRPC server on specified network and address.
-// network parameter can be "tcp" or "unix"
+// network parameter can be "tcp", "tcp4", "tcp6" or "unix"
 // server parameter is where you pass ready to use gRPC-server (see https://godoc.org/google.golang.org/grpc#NewServer)
 func ListenAndServeGRPC(network string, address string, server GRPCServer) error {
+	return defaultPack().ListenAndServeGRPC(network, address, server)
+}
+
+// ListenAndServeGRPCContext is the same as ListenAndServeGRPC but shutdown also starts when ctx is done
+func ListenAndServeGRPCContext(ctx context.Context, network string, address string, server GRPCServer) error {
+	return defaultPack().ListenAndServeGRPCContext(ctx, network, address, server)
+}
+
+// ListenAndServeGRPC starts gRPC server using config of the pack, see package-level ListenAndServeGRPC
+func (p *Pack) ListenAndServeGRPC(network string, address string, server GRPCServer) error {
+	return p.ListenAndServeGRPCContext(context.Background(), network, address, server)
+}
+
+// ListenAndServeGRPCContext starts gRPC server using config of the pack, see package-level ListenAndServeGRPCContext
+func (p *Pack) ListenAndServeGRPCContext(ctx context.Context, network string, address string, server GRPCServer) error {
+	if err := validateNetwork(network, false); err != nil {
+		return err
+	}
+
 	// check if we are in main process
-	if isMainProcess {
-		return StartMainProcess()
+	if p.isMainProcess() {
+		return p.startMainProcessWithListener(ctx, network, address, false, p.mainServer(network, address,
+			func(ctx context.Context, l net.Listener) error { return p.runMainGRPCServer(ctx, l, server) }))
 	}
 
 	// we are in a worker process
@@ -30,42 +55,115 @@ func ListenAndServeGRPC(network string, address string, server GRPCServer) error
 	}
 
 	// setup runtime params
-	if err := setupWorkerRuntime(); err != nil {
+	if err := p.setupWorkerRuntime(); err != nil {
 		return err
 	}
 
 	// announce listener
-	l, err := getListenerWithSocketOptions(network, address)
+	l, err := p.getListenerWithSocketOptions(network, address)
 	if err != nil {
 		return err
 	}
 
+	return p.runGRPCServer(ctx, l, server)
+}
+
+// ServeGRPC starts gRPC server on listener created by caller (i.e. passed by systemd socket activation),
+// main process shares this listener with worker processes, so l can be nil in worker processes
+// (see IsMainProcess), gopherpack socket options are not applied to it
+func ServeGRPC(l net.Listener, server GRPCServer) error {
+	return defaultPack().ServeGRPC(l, server)
+}
+
+// ServeGRPCContext is the same as ServeGRPC but shutdown also starts when ctx is done
+func ServeGRPCContext(ctx context.Context, l net.Listener, server GRPCServer) error {
+	return defaultPack().ServeGRPCContext(ctx, l, server)
+}
+
+// ServeGRPC starts gRPC server using config of the pack, see package-level ServeGRPC
+func (p *Pack) ServeGRPC(l net.Listener, server GRPCServer) error {
+	return p.ServeGRPCContext(context.Background(), l, server)
+}
+
+// ServeGRPCContext starts gRPC server using config of the pack, see package-level ServeGRPCContext
+func (p *Pack) ServeGRPCContext(ctx context.Context, l net.Listener, server GRPCServer) error {
+	// check if we are in main process
+	if p.isMainProcess() {
+		return p.startMainProcessWithUserListener(ctx, l, p.mainServer("", "",
+			func(ctx context.Context, l net.Listener) error { return p.runMainGRPCServer(ctx, l, server) }))
+	}
+
+	// we are in a worker process
+	if server == nil {
+		return errors.New("nil server passed")
+	}
+
+	// setup runtime params
+	if err := p.setupWorkerRuntime(); err != nil {
+		return err
+	}
+
+	l, err := p.workerListener(l)
+	if err != nil {
+		return err
+	}
+
+	return p.runGRPCServer(ctx, l, server)
+}
+
+// runMainGRPCServer serves gRPC on listener of main process if MainAlsoServes is set
+func (p *Pack) runMainGRPCServer(ctx context.Context, l net.Listener, server GRPCServer) error {
+	if server == nil {
+		l.Close()
+		return errors.New("nil server passed")
+	}
+
+	return p.runGRPCServer(ctx, l, server)
+}
+
+// runGRPCServer serves gRPC on listener of worker process until shutdown signal is received
+func (p *Pack) runGRPCServer(ctx context.Context, l net.Listener, server GRPCServer) error {
+	p.logServing("gRPC", l.Addr())
+	l = p.wrapWithAcceptCounter(l)
+
 	// catch signals to do graceful shutdown
+	shutdown := p.watchShutdown(ctx)
+	defer shutdown.release()
+	shutdownDone := make(chan struct{})
 	go func() {
-		// wait for signals to worker process
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(
-			sigChan,
-			syscall.SIGINT,
-			syscall.SIGTERM,
-			syscall.SIGQUIT,
-		)
-		sig := <-sigChan
-		Logger.Printf("Worker process PID=%d received signal: %s. Shutdown gracefully\n", pid, sig)
-		// check if we need to run custom logic before calling shutdown
-		if OnServerShutdown != nil {
-			func() {
-				defer func() {
-					panicErr := recover()
-					Logger.Printf("Worker process PID=%d OnServerShutdown hook panicked: %s", pid, panicErr)
-				}()
-				OnServerShutdown()
-			}()
+		defer close(shutdownDone)
+		<-shutdown.started
+		// shutdown server gracefully within shutdown budget
+		stopper, ok := server.(GRPCForceStopper)
+		if !ok || p.cfg.ShutdownTimeout <= 0 {
+			server.GracefulStop()
+			return
+		}
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdown.ctx.Done():
+			p.warnf("Worker process PID=%d could not shutdown gracefully within %s, forcing stop\n",
+				pid,
+				p.cfg.ShutdownTimeout,
+			)
+			stopper.Stop()
 		}
-		// shutdown server gracefully
-		server.GracefulStop()
 	}()
 
+	// tell main process we are ready to serve
+	p.markReady()
+
 	// start serving gRPC traffic
-	return server.Serve(l)
+	err := server.Serve(l)
+	// wait for in-flight RPCs to be done if server was stopped
+	if err == nil {
+		<-shutdownDone
+	}
+
+	return err
 }
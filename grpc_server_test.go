@@ -0,0 +1,61 @@
+package gopherpack
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowGRPCServer is gRPC server which graceful stop waits for in-flight RPC until it is force stopped
+type slowGRPCServer struct {
+	stopOnce sync.Once
+	stopped  chan struct{}
+	forced   bool
+}
+
+func (s *slowGRPCServer) Serve(net.Listener) error {
+	<-s.stopped
+	return nil
+}
+
+func (s *slowGRPCServer) GracefulStop() {
+	<-s.stopped
+}
+
+func (s *slowGRPCServer) Stop() {
+	s.forced = true
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+func TestGRPCServerShutdownTimeout(t *testing.T) {
+	p := newSingleProcessPack(200 * time.Millisecond)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	server := &slowGRPCServer{stopped: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- p.ServeGRPCContext(ctx, l, server) }()
+
+	shutdownStarted := time.Now()
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("server returned %v", err)
+		}
+		if !server.forced {
+			t.Error("server is not force stopped")
+		}
+		if elapsed := time.Since(shutdownStarted); elapsed < p.cfg.ShutdownTimeout {
+			t.Errorf("server was force stopped after %s, before shutdown timeout", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit within shutdown timeout")
+	}
+}
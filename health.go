@@ -0,0 +1,46 @@
+package gopherpack
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+// healthHandler wraps handler of HTTP server to serve liveness and readiness endpoints,
+// both of them respond with 200 while worker process is serving and with 503 once its shutdown has begun,
+// readiness endpoint responds with 503 while worker process is unhealthy (see ReportUnhealthy) or draining too,
+// so orchestrator routes traffic away from it instead of restarting it
+func (p *Pack) healthHandler(handler http.Handler) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != livenessPath && req.URL.Path != readinessPath {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		status := "serving"
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		switch {
+		case !p.state.isServing():
+			status = "shutting down"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case p.state.isUnhealthy():
+			status = "unhealthy"
+			if req.URL.Path == readinessPath {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case p.state.isDraining():
+			status = "draining"
+			if req.URL.Path == readinessPath {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+		fmt.Fprintf(w, "%s, worker PID=%d, CPU core %s\n", status, pid, workerCpuCore)
+	})
+}
@@ -0,0 +1,40 @@
+package gopherpack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	p := newSingleProcessPack(0)
+	handler := p.healthHandler(http.NotFoundHandler())
+	check := func(path string, wantCode int, wantStatus string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != wantCode || !strings.HasPrefix(rec.Body.String(), wantStatus+",") {
+			t.Errorf("%s responded with %d %q, want %d %q", path, rec.Code, rec.Body.String(), wantCode, wantStatus)
+		}
+	}
+
+	p.state.setReady(true)
+	check(livenessPath, http.StatusOK, "serving")
+	check(readinessPath, http.StatusOK, "serving")
+
+	// unhealthy worker process is alive, only readiness fails so it is not restarted
+	p.ReportUnhealthy("database is down")
+	check(livenessPath, http.StatusOK, "unhealthy")
+	check(readinessPath, http.StatusServiceUnavailable, "unhealthy")
+	p.ReportHealthy()
+
+	p.Drain()
+	check(livenessPath, http.StatusOK, "draining")
+	check(readinessPath, http.StatusServiceUnavailable, "draining")
+	p.Undrain()
+
+	p.state.setReady(false)
+	check(livenessPath, http.StatusServiceUnavailable, "shutting down")
+	check(readinessPath, http.StatusServiceUnavailable, "shutting down")
+}
@@ -0,0 +1,105 @@
+package gopherpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// HttpServerSpec describes one of HTTP servers run by ListenAndServeHttpMulti
+type HttpServerSpec struct {
+	Network string
+	Address string
+	Server  *http.Server
+}
+
+// ListenAndServeHttpMulti starts several HTTP servers in each worker process (i.e. public API and admin endpoints),
+// all of them are shut down together on signal or when any of them fails, the first error is returned.
+// Listeners are never shared with main process (SharedListener is ignored)
+func ListenAndServeHttpMulti(specs []HttpServerSpec) error {
+	return defaultPack().ListenAndServeHttpMulti(specs)
+}
+
+// ListenAndServeHttpMultiContext is the same as ListenAndServeHttpMulti but shutdown also starts when ctx is done
+func ListenAndServeHttpMultiContext(ctx context.Context, specs []HttpServerSpec) error {
+	return defaultPack().ListenAndServeHttpMultiContext(ctx, specs)
+}
+
+// ListenAndServeHttpMulti starts HTTP servers using config of the pack, see package-level ListenAndServeHttpMulti
+func (p *Pack) ListenAndServeHttpMulti(specs []HttpServerSpec) error {
+	return p.ListenAndServeHttpMultiContext(context.Background(), specs)
+}
+
+// ListenAndServeHttpMultiContext starts HTTP servers using config of the pack, see package-level ListenAndServeHttpMultiContext
+func (p *Pack) ListenAndServeHttpMultiContext(ctx context.Context, specs []HttpServerSpec) error {
+	for _, spec := range specs {
+		if err := validateNetwork(spec.Network, false); err != nil {
+			return err
+		}
+	}
+
+	// check if we are in main process
+	if p.isMainProcess() {
+		return p.StartMainProcessContext(ctx)
+	}
+
+	// we are in a worker process
+	if len(specs) == 0 {
+		return errors.New("no servers passed")
+	}
+	for _, spec := range specs {
+		if spec.Server == nil {
+			return fmt.Errorf("nil server passed for %s/%s", spec.Network, spec.Address)
+		}
+	}
+
+	// setup runtime params
+	if err := p.setupWorkerRuntime(); err != nil {
+		return err
+	}
+
+	// announce all listeners before serving any of them
+	listeners := make([]net.Listener, 0, len(specs))
+	for _, spec := range specs {
+		p.prepareHttpServer(spec.Server)
+		l, err := p.getListenerWithSocketOptions(spec.Network, spec.Address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		p.logServing("HTTP", l.Addr())
+		listeners = append(listeners, l)
+	}
+
+	// catch signals to do graceful shutdown, failure of any server shuts down the rest
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	shutdown := p.watchShutdown(ctx)
+	defer shutdown.release()
+
+	// tell main process we are ready to serve
+	p.markReady()
+
+	errs := make(chan error, len(specs))
+	for i, spec := range specs {
+		go func(l net.Listener, server *http.Server) {
+			err := p.serveHttp(l, server, shutdown)
+			if err != http.ErrServerClosed {
+				cancel()
+			}
+			errs <- err
+		}(listeners[i], spec.Server)
+	}
+	var firstErr error
+	for range specs {
+		if err := <-errs; firstErr == nil || firstErr == http.ErrServerClosed {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
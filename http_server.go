@@ -3,19 +3,42 @@ package gopherpack
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // ListenAndServeHttp starts HTTP server on specified network and address.
-// network parameter can be "tcp" or "unix"
-// TLS is supported by passing non nil server.TLSConfig
+// network parameter can be "tcp", "tcp4", "tcp6" or "unix"
+// TLS is supported by passing non nil server.TLSConfig, it is replaced by its clone in worker process,
+// so caller keeps owning the config (i.e. to share it with other servers)
 func ListenAndServeHttp(network string, address string, server *http.Server) error {
+	return defaultPack().ListenAndServeHttp(network, address, server)
+}
+
+// ListenAndServeHttpContext is the same as ListenAndServeHttp but shutdown also starts when ctx is done
+func ListenAndServeHttpContext(ctx context.Context, network string, address string, server *http.Server) error {
+	return defaultPack().ListenAndServeHttpContext(ctx, network, address, server)
+}
+
+// ListenAndServeHttp starts HTTP server using config of the pack, see package-level ListenAndServeHttp
+func (p *Pack) ListenAndServeHttp(network string, address string, server *http.Server) error {
+	return p.ListenAndServeHttpContext(context.Background(), network, address, server)
+}
+
+// ListenAndServeHttpContext starts HTTP server using config of the pack, see package-level ListenAndServeHttpContext
+func (p *Pack) ListenAndServeHttpContext(ctx context.Context, network string, address string, server *http.Server) error {
+	if err := validateNetwork(network, false); err != nil {
+		return err
+	}
+
 	// check if we are in main process
-	if isMainProcess {
-		return StartMainProcess()
+	if p.isMainProcess() {
+		return p.startMainProcessWithListener(ctx, network, address, false, p.mainServer(network, address,
+			func(ctx context.Context, l net.Listener) error { return p.runMainHttpServer(ctx, l, server) }))
 	}
 
 	// we are in a worker process
@@ -24,48 +47,174 @@ func ListenAndServeHttp(network string, address string, server *http.Server) err
 	}
 
 	// setup runtime params
-	if err := setupWorkerRuntime(); err != nil {
+	if err := p.setupWorkerRuntime(); err != nil {
 		return err
 	}
 
+	p.prepareHttpServer(server)
+
 	// announce listener
-	l, err := getListenerWithSocketOptions(network, address)
+	l, err := p.getListenerWithSocketOptions(network, address)
 	if err != nil {
 		return err
 	}
 
+	return p.runHttpServer(ctx, l, server)
+}
+
+// ServeHttp starts HTTP server on listener created by caller (i.e. passed by systemd socket activation),
+// main process shares this listener with worker processes, so l can be nil in worker processes
+// (see IsMainProcess), gopherpack socket options are not applied to it.
+// TLS is supported by passing non nil server.TLSConfig
+func ServeHttp(l net.Listener, server *http.Server) error {
+	return defaultPack().ServeHttp(l, server)
+}
+
+// ServeHttpContext is the same as ServeHttp but shutdown also starts when ctx is done
+func ServeHttpContext(ctx context.Context, l net.Listener, server *http.Server) error {
+	return defaultPack().ServeHttpContext(ctx, l, server)
+}
+
+// ServeHttp starts HTTP server using config of the pack, see package-level ServeHttp
+func (p *Pack) ServeHttp(l net.Listener, server *http.Server) error {
+	return p.ServeHttpContext(context.Background(), l, server)
+}
+
+// ServeHttpContext starts HTTP server using config of the pack, see package-level ServeHttpContext
+func (p *Pack) ServeHttpContext(ctx context.Context, l net.Listener, server *http.Server) error {
+	// check if we are in main process
+	if p.isMainProcess() {
+		return p.startMainProcessWithUserListener(ctx, l, p.mainServer("", "",
+			func(ctx context.Context, l net.Listener) error { return p.runMainHttpServer(ctx, l, server) }))
+	}
+
+	// we are in a worker process
+	if server == nil {
+		return errors.New("nil server passed")
+	}
+
+	// setup runtime params
+	if err := p.setupWorkerRuntime(); err != nil {
+		return err
+	}
+
+	p.prepareHttpServer(server)
+
+	l, err := p.workerListener(l)
+	if err != nil {
+		return err
+	}
+
+	return p.runHttpServer(ctx, l, server)
+}
+
+// runHttpServer serves HTTP on listener of worker process until shutdown signal is received
+func (p *Pack) runHttpServer(ctx context.Context, l net.Listener, server *http.Server) error {
+	p.logServing("HTTP", l.Addr())
+
 	// catch signals to do graceful shutdown
-	go func() {
-		// wait for signals to worker process
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(
-			sigChan,
-			syscall.SIGINT,
-			syscall.SIGTERM,
-			syscall.SIGQUIT,
-		)
-		sig := <-sigChan
-		Logger.Printf("Worker process PID=%d received signal: %s. Shutdown gracefully\n", pid, sig)
-		// check if we need to run custom logic before calling shutdown
-		if OnServerShutdown != nil {
-			func() {
-				defer func() {
-					panicErr := recover()
-					Logger.Printf("Worker process PID=%d OnServerShutdown hook panicked: %s", pid, panicErr)
-				}()
-				OnServerShutdown()
-			}()
+	shutdown := p.watchShutdown(ctx)
+	defer shutdown.release()
+
+	// tell main process we are ready to serve
+	p.markReady()
+
+	return p.serveHttp(l, server, shutdown)
+}
+
+// runMainHttpServer serves HTTP on listener of main process if MainAlsoServes is set
+func (p *Pack) runMainHttpServer(ctx context.Context, l net.Listener, server *http.Server) error {
+	if server == nil {
+		l.Close()
+		return errors.New("nil server passed")
+	}
+	p.prepareHttpServer(server)
+
+	return p.runHttpServer(ctx, l, server)
+}
+
+// prepareHttpServer wraps handler of the server according to config of the pack
+func (p *Pack) prepareHttpServer(server *http.Server) {
+	// let handlers to learn which worker process serves request, see CoreFromContext
+	if server.BaseContext == nil {
+		server.BaseContext = p.baseContext
+	}
+	// use own copy of TLS config which may be shared by caller with other servers,
+	// and resume TLS sessions on any worker process
+	server.TLSConfig = server.TLSConfig.Clone()
+	setSessionTicketKeys(server.TLSConfig)
+	p.setCertificateGetter(server.TLSConfig)
+	// recycle worker process after serving MaxRequests requests, health checks are not counted,
+	// server of main process (see MainAlsoServes) is not recycled
+	if p.cfg.MaxRequests > 0 && !p.isMainProcess() {
+		server.Handler = p.countRequests(server.Handler)
+	}
+	// serve health endpoints along with handler of the server
+	if p.cfg.HealthChecks {
+		server.Handler = p.healthHandler(server.Handler)
+	}
+	// serve HTTP/2 over plaintext listener
+	if p.cfg.H2C && server.TLSConfig == nil {
+		handler := server.Handler
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		server.Handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+}
+
+// countRequests wraps handler of HTTP server to recycle worker process once it served MaxRequests requests,
+// the request reaching the limit and the ones in-flight are completed by graceful shutdown.
+// Worker processes reach the limit at about the same time as connections are spread evenly over them,
+// so worker process asks main process to recycle it and main process recycles them one at a time
+func (p *Pack) countRequests(handler http.Handler) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&p.state.servedRequests, 1) == int64(p.cfg.MaxRequests) {
+			// there is nobody to wait for if main process serves too or there is no control channel
+			if p.isMainProcess() || controlPipe == nil {
+				p.infof("Worker process PID=%d served %d requests, recycling it\n", pid, p.cfg.MaxRequests)
+				p.recycle()
+			} else {
+				p.infof("Worker process PID=%d served %d requests, waiting for main process to recycle it\n",
+					pid, p.cfg.MaxRequests)
+				p.notifyMainProcess(msgRequests, "")
+			}
 		}
-		// shutdown server gracefully
-		if err := server.Shutdown(context.Background()); err != nil {
-			Logger.Printf("Worker process PID=%d could not shutdown gracefully: %s\n", pid, err)
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// serveHttp serves HTTP on listener until shutdown starts, then shuts server down gracefully
+func (p *Pack) serveHttp(l net.Listener, server *http.Server, shutdown *serverShutdown) error {
+	l = p.wrapWithAcceptCounter(l)
+	l = p.wrapWithProxyProtocol(l)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-shutdown.started
+		// shutdown server gracefully within shutdown budget
+		if err := server.Shutdown(shutdown.ctx); err != nil {
+			p.warnf("Worker process PID=%d could not shutdown gracefully: %s\n", pid, err)
+			// close connections which are still active
+			server.Close()
 		}
 	}()
 
+	var err error
 	if server.TLSConfig != nil {
-		Logger.Println("Using TLS")
-		return server.ServeTLS(l, "", "")
+		p.infof("Using TLS\n")
+		err = server.ServeTLS(l, "", "")
+	} else {
+		err = server.Serve(l)
+	}
+	// wait for in-flight requests to be done if server was shut down
+	if err == http.ErrServerClosed {
+		<-shutdownDone
 	}
 
-	return server.Serve(l)
+	return err
 }
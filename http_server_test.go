@@ -0,0 +1,64 @@
+package gopherpack
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newSingleProcessPack returns Pack which runs servers in current process with given ShutdownTimeout
+func newSingleProcessPack(shutdownTimeout time.Duration) *Pack {
+	cfg := DefaultConfig()
+	cfg.Logger = log.New(io.Discard, "", 0)
+	cfg.StructuredLogger = nil
+	cfg.SingleProcess = true
+	cfg.ShutdownTimeout = shutdownTimeout
+	cfg.PreShutdownDelay = 0
+
+	return New(cfg)
+}
+
+func TestHttpServerShutdownTimeout(t *testing.T) {
+	p := newSingleProcessPack(200 * time.Millisecond)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	// handler is slower than shutdown timeout
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(handling)
+		<-release
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- p.ServeHttpContext(ctx, l, server) }()
+	go http.Get("http://" + l.Addr().String())
+	select {
+	case <-handling:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is not handled")
+	}
+
+	shutdownStarted := time.Now()
+	cancel()
+	select {
+	case err := <-served:
+		if err != http.ErrServerClosed {
+			t.Errorf("server returned %v, want %v", err, http.ErrServerClosed)
+		}
+		if elapsed := time.Since(shutdownStarted); elapsed < p.cfg.ShutdownTimeout {
+			t.Errorf("server exited after %s, before in-flight request or shutdown timeout", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit within shutdown timeout")
+	}
+}
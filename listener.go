@@ -3,45 +3,317 @@ package gopherpack
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"os"
 	"strings"
 	"syscall"
+	"time"
+)
+
+// listener passed by parent process if listener is shared (see Config.SharedListener)
+var inheritedListener = inheritedFile(envListenerFD, "gopherpack-listener")
 
-	"golang.org/x/sys/unix"
+// networks supported by stream and packet servers
+var (
+	streamNetworks = []string{"tcp", "tcp4", "tcp6", "unix"}
+	packetNetworks = []string{"udp", "udp4", "udp6", "unixgram"}
 )
 
-func getListenerWithSocketOptions(network string, address string) (net.Listener, error) {
-	listenConf := &net.ListenConfig{
-		Control: func(network, address string, c syscall.RawConn) error {
-			var err, reuseAddrErr, reusePortErr, returnErr error
-			err = c.Control(func(fd uintptr) {
-				reuseAddrErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
-				reusePortErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
-			})
-
-			errMsg := []string{}
-			if err != nil {
-				errMsg = append(errMsg, err.Error())
-			}
-			if reuseAddrErr != nil {
-				errMsg = append(errMsg, reuseAddrErr.Error())
-			}
-			if reusePortErr != nil {
-				errMsg = append(errMsg, reusePortErr.Error())
-			}
-
-			if len(errMsg) > 0 {
-				returnErr = errors.New(strings.Join(errMsg, ";"))
-			}
-
-			return returnErr
-		},
-	}
-
-	l, err := listenConf.Listen(context.Background(), network, address)
+// validateNetwork returns error naming supported networks if network is not one of them
+func validateNetwork(network string, packet bool) error {
+	supported := streamNetworks
+	if packet {
+		supported = packetNetworks
+	}
+	for _, supportedNetwork := range supported {
+		if network == supportedNetwork {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported network %q, it can be one of: %s", network, strings.Join(supported, ", "))
+}
+
+// ListenerAddr returns address of listener of current worker process (i.e. to find out port when listening on ":0"),
+// it returns nil in main process and before listener is created
+func ListenerAddr() net.Addr {
+	return defaultState.getListenerAddr()
+}
+
+// ListenerAddr returns address of listener of the pack, see package-level ListenerAddr
+func (p *Pack) ListenerAddr() net.Addr {
+	return p.state.getListenerAddr()
+}
+
+func (s *packState) getListenerAddr() net.Addr {
+	s.listenerAddrMu.Lock()
+	defer s.listenerAddrMu.Unlock()
+
+	return s.listenerAddr
+}
+
+// setListenerAddr remembers address of listener if it was created by worker process
+func (p *Pack) setListenerAddr(addr net.Addr) {
+	if p.isMainProcess() {
+		return
+	}
+	p.state.listenerAddrMu.Lock()
+	p.state.listenerAddr = addr
+	p.state.listenerAddrMu.Unlock()
+}
+
+func (p *Pack) getListenerWithSocketOptions(network string, address string) (net.Listener, error) {
+	// use listener shared by main process if any
+	if inheritedListener != nil {
+		return p.useInheritedListener()
+	}
+	// use socket passed by systemd if any
+	if file := p.takeSystemdSocket(network, address, false); file != nil {
+		defer file.Close()
+		l, err := net.FileListener(file)
+		if err != nil {
+			p.errorf("Could not use socket passed by systemd: %s\n", err)
+			return nil, err
+		}
+		p.setListenerAddr(l.Addr())
+		return l, nil
+	}
+
+	if isUnixNetwork(network) && p.cfg.RemoveStaleUnixSocket {
+		p.removeStaleUnixSocket(network, address)
+	}
+
+	listenConf := p.listenConfig()
+
+	var l net.Listener
+	err := p.retryBind(network, address, func() (err error) {
+		l, err = listenConf.Listen(context.Background(), network, address)
+		return err
+	})
+	if err != nil {
+		p.errorf("Could not start listener on %s/%s: %s\n", network, address, err)
+		return nil, fmt.Errorf("%w %s/%s: %w", ErrBindFailed, network, address, err)
+	}
+	if isUnixNetwork(network) {
+		if err := p.setUnixSocketMode(address); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	p.infof("Starting listener on %s\n", l.Addr())
+	p.setListenerAddr(l.Addr())
+
+	return l, nil
+}
+
+// useInheritedListener returns listener shared by main process
+func (p *Pack) useInheritedListener() (net.Listener, error) {
+	l, err := net.FileListener(inheritedListener)
+	if err != nil {
+		p.errorf("Could not use shared listener: %s\n", err)
+		return nil, err
+	}
+	inheritedListener.Close()
+	p.infof("Using shared listener on %s\n", l.Addr())
+	p.setListenerAddr(l.Addr())
+
+	return l, nil
+}
+
+// workerListener returns listener worker process serves on if caller created listener itself,
+// listener shared by main process is preferred and the one created by caller (if any) is closed then
+func (p *Pack) workerListener(l net.Listener) (net.Listener, error) {
+	if inheritedListener != nil {
+		if l != nil {
+			l.Close()
+		}
+		return p.useInheritedListener()
+	}
+	if l == nil {
+		return nil, errors.New("nil listener passed")
+	}
+	p.setListenerAddr(l.Addr())
+
+	return l, nil
+}
+
+func (p *Pack) getPacketConnWithSocketOptions(network string, address string) (net.PacketConn, error) {
+	// use packet connection shared by main process if any
+	if inheritedListener != nil {
+		conn, err := net.FilePacketConn(inheritedListener)
+		if err != nil {
+			p.errorf("Could not use shared packet listener: %s\n", err)
+			return nil, err
+		}
+		inheritedListener.Close()
+		p.infof("Using shared packet listener on %s\n", conn.LocalAddr())
+		p.setListenerAddr(conn.LocalAddr())
+		return conn, nil
+	}
+	// use socket passed by systemd if any
+	if file := p.takeSystemdSocket(network, address, true); file != nil {
+		defer file.Close()
+		conn, err := net.FilePacketConn(file)
+		if err != nil {
+			p.errorf("Could not use socket passed by systemd: %s\n", err)
+			return nil, err
+		}
+		p.setListenerAddr(conn.LocalAddr())
+		return conn, nil
+	}
+
+	if isUnixNetwork(network) && p.cfg.RemoveStaleUnixSocket {
+		p.removeStaleUnixSocket(network, address)
+	}
+
+	listenConf := p.listenConfig()
+
+	var conn net.PacketConn
+	err := p.retryBind(network, address, func() (err error) {
+		conn, err = listenConf.ListenPacket(context.Background(), network, address)
+		return err
+	})
+	if err != nil {
+		p.errorf("Could not start packet listener on %s/%s: %s\n", network, address, err)
+		return nil, fmt.Errorf("%w %s/%s: %w", ErrBindFailed, network, address, err)
+	}
+	if isUnixNetwork(network) {
+		if err := p.setUnixSocketMode(address); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	p.infof("Starting packet listener on %s\n", conn.LocalAddr())
+	p.setListenerAddr(conn.LocalAddr())
+
+	return conn, nil
+}
+
+// listenConfig returns config to create listeners with, socket options of the pack are set
+// before Control of user supplied ListenConfig is called
+func (p *Pack) listenConfig() *net.ListenConfig {
+	listenConf := &net.ListenConfig{}
+	if p.cfg.ListenConfig != nil {
+		*listenConf = *p.cfg.ListenConfig
+	}
+	userControl := listenConf.Control
+	listenConf.Control = func(network string, address string, c syscall.RawConn) error {
+		if err := p.setSocketOptions(network, address, c); err != nil {
+			return err
+		}
+		if userControl != nil {
+			return userControl(network, address, c)
+		}
+		return nil
+	}
+
+	return listenConf
+}
+
+// retryBind calls listen until it succeeds or fails with error other than "address already in use",
+// it is retried up to BindRetries times waiting BindRetryInterval doubled after each attempt
+func (p *Pack) retryBind(network string, address string, listen func() error) error {
+	interval := p.cfg.BindRetryInterval
+	for attempt := 1; ; attempt++ {
+		err := listen()
+		if err == nil || attempt > p.cfg.BindRetries || !isAddrInUse(err) {
+			return err
+		}
+		p.warnf("Address %s/%s is in use, retrying to bind in %s (attempt %d of %d)\n",
+			network, address, interval, attempt, p.cfg.BindRetries)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// logServing logs address worker process serves on, it is logged once per server right after listener is obtained
+func (p *Pack) logServing(serverType string, addr net.Addr) {
+	cpuCore := workerCpuCore
+	if cpuCore == "" || p.cfg.DisableAffinity {
+		cpuCore = "none"
+	}
+	p.infof("%s PID=%d %s server serving on %s %s (CPU core %s)\n",
+		p.processName(),
+		pid,
+		serverType,
+		addr.Network(),
+		addr,
+		cpuCore,
+	)
+}
+
+// filer is implemented by listeners and packet connections which can return their socket as a file
+type filer interface {
+	File() (*os.File, error)
+}
+
+// startMainProcessWithListener runs main process which shares listener with workers if it is configured
+// or if kernel does not support SO_REUSEPORT, socket passed by systemd socket activation is always shared with workers
+func (p *Pack) startMainProcessWithListener(ctx context.Context, network string, address string, packet bool, serve mainServeFunc) error {
+	// listener was passed by previous main process during executable upgrade
+	if inheritedListener != nil {
+		return p.startMainProcess(ctx, inheritedListener, serve)
+	}
+
+	// workers can't bind the address on their own while systemd socket is bound to it
+	if file := p.takeSystemdSocket(network, address, packet); file != nil {
+		return p.startMainProcess(ctx, file, serve)
+	}
+
+	// worker processes can't bind the same address on their own without SO_REUSEPORT, so share listener instead
+	shared := p.cfg.SharedListener
+	if !shared && !isUnixNetwork(network) {
+		if err := reusePortSupported(); err != nil {
+			p.warnf("Main process PID=%d SO_REUSEPORT is not available (%s), sharing listener with worker processes\n",
+				pid, err)
+			shared = true
+		}
+	}
+	if !shared {
+		return p.startMainProcess(ctx, nil, serve)
+	}
+
+	var socket interface{}
+	var err error
+	if packet {
+		socket, err = p.getPacketConnWithSocketOptions(network, address)
+	} else {
+		socket, err = p.getListenerWithSocketOptions(network, address)
+	}
+	if err != nil {
+		return err
+	}
+	socketFiler, ok := socket.(filer)
+	if !ok {
+		return fmt.Errorf("listener on %s/%s can't be shared", network, address)
+	}
+	listenerFile, err := socketFiler.File()
+	if err != nil {
+		return err
+	}
+
+	return p.startMainProcess(ctx, listenerFile, serve)
+}
+
+// startMainProcessWithUserListener runs main process which shares listener created by caller with workers,
+// new main process started by executable upgrade keeps using listener of previous main process
+func (p *Pack) startMainProcessWithUserListener(ctx context.Context, l net.Listener, serve mainServeFunc) error {
+	if l == nil {
+		return errors.New("nil listener passed")
+	}
+	if inheritedListener != nil {
+		l.Close()
+		return p.startMainProcess(ctx, inheritedListener, serve)
+	}
+	socketFiler, ok := l.(filer)
+	if !ok {
+		return fmt.Errorf("listener on %s can't be shared", l.Addr())
+	}
+	listenerFile, err := socketFiler.File()
 	if err != nil {
-		Logger.Printf("Starting listener on %s\n", l.Addr())
+		return err
 	}
 
-	return l, err
+	return p.startMainProcess(ctx, listenerFile, serve)
 }
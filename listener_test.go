@@ -0,0 +1,39 @@
+package gopherpack
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+)
+
+func TestGetListenerBindFailure(t *testing.T) {
+	inUse, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer inUse.Close()
+
+	cfg := DefaultConfig()
+	cfg.Logger = log.New(io.Discard, "", 0)
+	cfg.SingleProcess = true
+	cfg.BindRetries = 0
+	p := New(cfg)
+
+	for name, address := range map[string]string{
+		"address in use":  inUse.Addr().String(),
+		"invalid address": "127.0.0.1:99999",
+	} {
+		t.Run(name, func(t *testing.T) {
+			l, err := p.getListenerWithSocketOptions("tcp", address)
+			if !errors.Is(err, ErrBindFailed) {
+				t.Errorf("error %v does not wrap ErrBindFailed", err)
+			}
+			if l != nil {
+				l.Close()
+				t.Errorf("listener is returned on bind failure")
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package gopherpack
 
+import (
+	"fmt"
+	"strings"
+)
+
 // StdLogger provides interface to set alternative logger
 type StdLogger interface {
 	Print(...interface{})
@@ -14,3 +19,61 @@ type StdLogger interface {
 	Panicf(string, ...interface{})
 	Panicln(...interface{})
 }
+
+// LeveledLogger provides interface to set structured logger with levels (i.e. *slog.Logger),
+// messages are passed along with key/value pairs describing process which logged them
+type LeveledLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// logf logs message with StructuredLogger if it is set, otherwise with StdLogger
+func (p *Pack) logf(level logLevel, format string, args ...interface{}) {
+	if p.cfg.StructuredLogger == nil {
+		p.cfg.Logger.Printf(format, args...)
+		return
+	}
+
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	keyvals := []interface{}{"pid", pid, "process", p.processName()}
+	if workerCpuCore != "" {
+		keyvals = append(keyvals, "core", workerCpuCore)
+	}
+	switch level {
+	case levelDebug:
+		p.cfg.StructuredLogger.Debug(msg, keyvals...)
+	case levelInfo:
+		p.cfg.StructuredLogger.Info(msg, keyvals...)
+	case levelWarn:
+		p.cfg.StructuredLogger.Warn(msg, keyvals...)
+	default:
+		p.cfg.StructuredLogger.Error(msg, keyvals...)
+	}
+}
+
+func (p *Pack) debugf(format string, args ...interface{}) {
+	p.logf(levelDebug, format, args...)
+}
+
+func (p *Pack) infof(format string, args ...interface{}) {
+	p.logf(levelInfo, format, args...)
+}
+
+func (p *Pack) warnf(format string, args ...interface{}) {
+	p.logf(levelWarn, format, args...)
+}
+
+func (p *Pack) errorf(format string, args ...interface{}) {
+	p.logf(levelError, format, args...)
+}
@@ -0,0 +1,57 @@
+package gopherpack
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/dencoded/gopherpack/system"
+)
+
+// mainServeFunc serves in main process along with worker processes if MainAlsoServes is set,
+// listenerFile is a listener shared with worker processes (can be nil)
+type mainServeFunc func(ctx context.Context, listenerFile *os.File) error
+
+// mainServer returns function to serve in main process with, run serves on listener of main process,
+// nil is returned if MainAlsoServes is not set
+func (p *Pack) mainServer(network string, address string, run func(ctx context.Context, l net.Listener) error) mainServeFunc {
+	if !p.cfg.MainAlsoServes {
+		return nil
+	}
+
+	return func(ctx context.Context, listenerFile *os.File) error {
+		if _, _, err := system.RaiseFileLimit(); err != nil {
+			return err
+		}
+		if err := p.loadTLSCertFile(); err != nil {
+			return err
+		}
+		// main process serves on its own copy of shared listener, or binds address with SO_REUSEPORT as workers do
+		var l net.Listener
+		var err error
+		if listenerFile != nil {
+			l, err = net.FileListener(listenerFile)
+		} else {
+			l, err = p.getListenerWithSocketOptions(network, address)
+		}
+		if err != nil {
+			return err
+		}
+
+		return run(ctx, l)
+	}
+}
+
+// serveInMainProcess runs serve until ctx is done, returned channel is closed once serving is done
+func (p *Pack) serveInMainProcess(ctx context.Context, serve mainServeFunc, listenerFile *os.File) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := serve(ctx, listenerFile); err != nil && err != http.ErrServerClosed {
+			p.errorf("Main process PID=%d server exited, worker processes keep serving: %s\n", pid, err)
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,74 @@
+package gopherpack
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// ListenAndServePacket starts packet (i.e. UDP) server on specified network and address.
+// network parameter can be "udp", "udp4", "udp6" or "unixgram"
+// handler parameter is a callback function called once with bound packet connection,
+// it should read and handle packets until connection gets closed on graceful shutdown
+func ListenAndServePacket(network string, address string, handler func(net.PacketConn)) error {
+	return defaultPack().ListenAndServePacket(network, address, handler)
+}
+
+// ListenAndServePacketContext is the same as ListenAndServePacket but shutdown also starts when ctx is done
+func ListenAndServePacketContext(ctx context.Context, network string, address string, handler func(net.PacketConn)) error {
+	return defaultPack().ListenAndServePacketContext(ctx, network, address, handler)
+}
+
+// ListenAndServePacket starts packet server using config of the pack, see package-level ListenAndServePacket
+func (p *Pack) ListenAndServePacket(network string, address string, handler func(net.PacketConn)) error {
+	return p.ListenAndServePacketContext(context.Background(), network, address, handler)
+}
+
+// ListenAndServePacketContext starts packet server using config of the pack, see package-level ListenAndServePacketContext
+func (p *Pack) ListenAndServePacketContext(ctx context.Context, network string, address string, handler func(net.PacketConn)) error {
+	if err := validateNetwork(network, true); err != nil {
+		return err
+	}
+
+	// check if we are in main process
+	if p.isMainProcess() {
+		return p.startMainProcessWithListener(ctx, network, address, true, nil)
+	}
+
+	// we are in a worker process
+	if handler == nil {
+		return errors.New("nil handler passed")
+	}
+
+	// setup runtime params
+	if err := p.setupWorkerRuntime(); err != nil {
+		return err
+	}
+
+	// announce packet listener
+	conn, err := p.getPacketConnWithSocketOptions(network, address)
+	if err != nil {
+		return err
+	}
+	p.logServing("packet", conn.LocalAddr())
+	defer conn.Close()
+
+	// catch signals to do graceful shutdown
+	shutdown := p.watchShutdown(ctx)
+	defer shutdown.release()
+	go func() {
+		<-shutdown.started
+		// closing connection makes handler's read calls to fail
+		if err := conn.Close(); err != nil {
+			p.warnf("Worker process PID=%d could not close packet connection: %s\n", pid, err)
+		}
+	}()
+
+	// tell main process we are ready to serve
+	p.markReady()
+
+	// start handling packets
+	handler(conn)
+
+	return nil
+}
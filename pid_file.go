@@ -0,0 +1,50 @@
+package gopherpack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writePIDFile writes PID of main process to PIDFile, file is replaced atomically so monitors never read it partially
+func (p *Pack) writePIDFile() error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(p.cfg.PIDFile), filepath.Base(p.cfg.PIDFile)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := fmt.Fprintf(tmpFile, "%d\n", pid); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), p.cfg.PIDFile); err != nil {
+		return err
+	}
+	p.infof("Main process PID=%d wrote PID file %s\n", pid, p.cfg.PIDFile)
+
+	return nil
+}
+
+// removePIDFile removes PIDFile if it contains PID of current main process,
+// file rewritten by new main process during executable upgrade is kept
+func (p *Pack) removePIDFile() {
+	data, err := os.ReadFile(p.cfg.PIDFile)
+	if err != nil {
+		return
+	}
+	if filePID, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil || filePID != pid {
+		return
+	}
+	if err := os.Remove(p.cfg.PIDFile); err != nil {
+		p.warnf("Main process PID=%d could not remove PID file %s: %s\n", pid, p.cfg.PIDFile, err)
+	}
+}
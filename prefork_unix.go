@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package gopherpack
+
+import (
+	"errors"
+	"syscall"
+)
+
+// preforkSupported tells if main process can fork and control worker processes on this platform
+const preforkSupported = true
+
+// sigUpgrade is a signal to start executable upgrade in main process
+const sigUpgrade = syscall.SIGUSR2
+
+// sigConfigReload is a signal to reload config of worker processes in place
+const sigConfigReload = syscall.SIGHUP
+
+// sigDrain is a signal to start draining in worker process. There is no default signal to stop draining:
+// SIGUSR2 starts executable upgrade when sent to main process, so undrain is not left one mistargeted kill away
+const sigDrain = syscall.SIGUSR1
+
+// isAddrInUse tells if error is returned because address is already bound by another socket
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
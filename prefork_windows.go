@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package gopherpack
+
+import (
+	"errors"
+	"syscall"
+)
+
+// preforkSupported tells if main process can fork and control worker processes on this platform,
+// on Windows a server runs as a single process without main process
+const preforkSupported = false
+
+// sigUpgrade is a signal to start executable upgrade in main process,
+// Windows has no SIGUSR2 and this signal is never delivered there
+const sigUpgrade = syscall.Signal(0x1f)
+
+// sigConfigReload is a signal to reload config of worker processes in place,
+// it is never delivered on Windows
+const sigConfigReload = syscall.SIGHUP
+
+// sigDrain is a signal to start draining in worker process,
+// Windows has no SIGUSR1 so it is never delivered there (use Drain and Undrain instead)
+const sigDrain = syscall.Signal(0x1e)
+
+// WSAEADDRINUSE is returned by Windows sockets if address is already bound by another socket
+const wsaeAddrInUse = syscall.Errno(10048)
+
+// isAddrInUse tells if error is returned because address is already bound by another socket
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeAddrInUse)
+}
@@ -2,16 +2,30 @@ package gopherpack
 
 import (
 	"os"
-	"os/exec"
 	"strings"
+	"sync"
 	"syscall"
 )
 
-func forkProcess(envValues []string) (*os.Process, error) {
+// forkProcess starts child process running executable of the pack (see Config.ExecutablePath),
+// upgrade is true if new main process is started during executable upgrade
+func (p *Pack) forkProcess(upgrade bool, envValues []string, extraFiles ...*os.File) (*os.Process, error) {
 	// get file path to current binary
-	filePath, err := exec.LookPath(os.Args[0])
-	if err != nil {
-		return nil, err
+	filePath := p.cfg.ExecutablePath
+	if filePath == "" {
+		var err error
+		if upgrade {
+			filePath, err = p.upgradeExecutable()
+		} else {
+			filePath, err = workerExecutable()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	args := os.Args
+	if p.cfg.ExecutableArgs != nil {
+		args = p.cfg.ExecutableArgs
 	}
 
 	// current dir
@@ -25,15 +39,28 @@ func forkProcess(envValues []string) (*os.Process, error) {
 	files[syscall.Stdin] = os.Stdin
 	files[syscall.Stdout] = os.Stdout
 	files[syscall.Stderr] = os.Stderr
+	// extra files get descriptors starting from 3 (see extraFileFD)
+	files = append(files, extraFiles...)
 
 	// prepare environment for child process
-	env := []string{}
-	// copy current environment vars but remove all existing gopherpack vars if any
-	for _, curEnvVar := range os.Environ() {
-		if strings.HasPrefix(curEnvVar, envPrefix) {
-			continue
+	base := baseEnv()
+	env := make([]string, 0, len(base)+len(envValues))
+	// vars passed by caller override current ones, gopherpack vars are not in base environment already
+	overridden := map[string]bool{}
+	for _, envVar := range envValues {
+		if name := envVarName(envVar); !isGopherpackEnvVar(name) {
+			overridden[name] = true
+		}
+	}
+	if len(overridden) == 0 {
+		env = append(env, base...)
+	} else {
+		for _, curEnvVar := range base {
+			if overridden[envVarName(curEnvVar)] {
+				continue
+			}
+			env = append(env, curEnvVar)
 		}
-		env = append(env, curEnvVar)
 	}
 	// add gopherpack environment vars
 	env = append(
@@ -44,12 +71,12 @@ func forkProcess(envValues []string) (*os.Process, error) {
 	// run child process
 	childProcess, err := os.StartProcess(
 		filePath,
-		os.Args,
+		args,
 		&os.ProcAttr{
 			Dir:   dir,
 			Env:   env,
 			Files: files,
-			Sys:   &syscall.SysProcAttr{},
+			Sys:   p.sysProcAttr(upgrade),
 		},
 	)
 	if err != nil {
@@ -58,3 +85,37 @@ func forkProcess(envValues []string) (*os.Process, error) {
 
 	return childProcess, nil
 }
+
+// environment of current process without gopherpack vars, it is taken once on first fork
+// and shared by all child processes (including new main process during executable upgrade)
+var (
+	baseEnvOnce sync.Once
+	baseEnvVars []string
+)
+
+// baseEnv returns environment child processes inherit from current process
+func baseEnv() []string {
+	baseEnvOnce.Do(func() {
+		for _, curEnvVar := range os.Environ() {
+			if !isGopherpackEnvVar(envVarName(curEnvVar)) {
+				baseEnvVars = append(baseEnvVars, curEnvVar)
+			}
+		}
+	})
+
+	return baseEnvVars
+}
+
+// extraFileFD returns descriptor which child process gets for extra file with given index
+func extraFileFD(index int) int {
+	return 3 + index
+}
+
+// envVarName returns name of env var given as "name=value"
+func envVarName(envVar string) string {
+	if i := strings.Index(envVar, "="); i >= 0 {
+		return envVar[:i]
+	}
+
+	return envVar
+}
@@ -0,0 +1,11 @@
+package gopherpack
+
+import "syscall"
+
+// setParentDeathSignal makes kernel to send sig to worker process when main process dies (i.e. killed with SIGKILL),
+// Pdeathsig of WorkerSysProcAttr takes precedence
+func setParentDeathSignal(attr *syscall.SysProcAttr, sig syscall.Signal) {
+	if attr.Pdeathsig == 0 {
+		attr.Pdeathsig = sig
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package gopherpack
+
+import "syscall"
+
+// setParentDeathSignal does nothing, parent death signal is supported on Linux only
+func setParentDeathSignal(attr *syscall.SysProcAttr, sig syscall.Signal) {}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package gopherpack
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysProcAttr returns attributes of child process, upgrade is true for new main process
+func (p *Pack) sysProcAttr(upgrade bool) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{}
+	if upgrade {
+		return attr
+	}
+	if p.cfg.WorkerSysProcAttr != nil {
+		*attr = *p.cfg.WorkerSysProcAttr
+	}
+	if p.cfg.ParentDeathSignal != 0 {
+		setParentDeathSignal(attr, p.cfg.ParentDeathSignal)
+	}
+	// worker processes drop privileges, new main process keeps them to be able to fork workers with credentials
+	if attr.Credential == nil && (p.cfg.WorkerUID > 0 || p.cfg.WorkerGID > 0) {
+		uid := os.Getuid()
+		if p.cfg.WorkerUID > 0 {
+			uid = p.cfg.WorkerUID
+		}
+		gid := os.Getgid()
+		if p.cfg.WorkerGID > 0 {
+			gid = p.cfg.WorkerGID
+		}
+		attr.Credential = &syscall.Credential{
+			Uid:    uint32(uid),
+			Gid:    uint32(gid),
+			Groups: []uint32{},
+		}
+	}
+
+	return attr
+}
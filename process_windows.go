@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package gopherpack
+
+import "syscall"
+
+// sysProcAttr returns attributes of child process, worker credentials are not supported on Windows
+func (p *Pack) sysProcAttr(upgrade bool) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{}
+	if !upgrade && p.cfg.WorkerSysProcAttr != nil {
+		*attr = *p.cfg.WorkerSysProcAttr
+	}
+
+	return attr
+}
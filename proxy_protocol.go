@@ -0,0 +1,309 @@
+package gopherpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// time given to client to send PROXY protocol header
+	proxyHeaderTimeout = 5 * time.Second
+	// number of accepted connections which can wait for PROXY protocol header at the same time,
+	// once it is reached listener stops accepting so new connections are kept in listen backlog of the kernel
+	maxPendingProxyConns = 128
+	// maximum length of PROXY protocol v1 header including CRLF
+	maxProxyV1HeaderLen = 107
+)
+
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// errNoProxyHeader is returned if connection does not start with PROXY protocol header
+var errNoProxyHeader = errors.New("no PROXY protocol header")
+
+// proxyProtocolListener reads PROXY protocol header of accepted connections in background,
+// so slow clients do not block Accept and connections are returned with addresses from the header
+type proxyProtocolListener struct {
+	net.Listener
+	p *Pack
+
+	startOnce sync.Once
+	conns     chan net.Conn
+	errs      chan error
+	pending   chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+	// closed once wrapped listener fails permanently, acceptErr is returned by every Accept then
+	done      chan struct{}
+	acceptErr error
+}
+
+// wrapWithProxyProtocol wraps listener to parse PROXY protocol headers if ProxyProtocol is set
+func (p *Pack) wrapWithProxyProtocol(l net.Listener) net.Listener {
+	if p.cfg.ProxyProtocol == ProxyProtocolOff {
+		return l
+	}
+
+	return &proxyProtocolListener{
+		Listener: l,
+		p:        p,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		pending:  make(chan struct{}, maxPendingProxyConns),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	l.startOnce.Do(func() { go l.acceptLoop() })
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, l.acceptErr
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *proxyProtocolListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts connections from wrapped listener and reads their headers,
+// temporary accept errors are passed to Accept one at a time so its caller can back off,
+// permanent error stops the loop and is returned by all following calls of Accept
+func (l *proxyProtocolListener) acceptLoop() {
+	for {
+		select {
+		case l.pending <- struct{}{}:
+		case <-l.closed:
+			return
+		}
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			<-l.pending
+			if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
+				l.acceptErr = err
+				close(l.done)
+				return
+			}
+			select {
+			case l.errs <- err:
+			case <-l.closed:
+				return
+			}
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake reads header of connection and passes connection to Accept, invalid connections are closed
+func (l *proxyProtocolListener) handshake(conn net.Conn) {
+	defer func() { <-l.pending }()
+	proxied, err := l.p.readProxyHeader(conn)
+	if err != nil {
+		if l.p.cfg.LogConnections {
+			l.p.debugf("Worker process PID=%d could not read PROXY protocol header from %s: %s\n",
+				pid,
+				conn.RemoteAddr(),
+				err,
+			)
+		}
+		conn.Close()
+		return
+	}
+	select {
+	case l.conns <- proxied:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// proxyConn is a connection with addresses taken from PROXY protocol header
+type proxyConn struct {
+	net.Conn
+	r          *bufio.Reader
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+// readProxyHeader reads PROXY protocol header of connection within proxyHeaderTimeout,
+// connection without header is returned as is in optional mode
+func (p *Pack) readProxyHeader(conn net.Conn) (net.Conn, error) {
+	conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	c := &proxyConn{Conn: conn, r: bufio.NewReader(conn)}
+	var err error
+	switch version, sigErr := detectProxyVersion(c.r); {
+	case sigErr != nil:
+		err = sigErr
+	case version == 1:
+		c.remoteAddr, c.localAddr, err = readProxyV1Header(c.r)
+	case version == 2:
+		c.remoteAddr, c.localAddr, err = readProxyV2Header(c.r)
+	default:
+		err = errNoProxyHeader
+	}
+	if err == errNoProxyHeader && p.cfg.ProxyProtocol == ProxyProtocolOptional {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// detectProxyVersion peeks first bytes of connection and returns version of PROXY protocol header,
+// zero version is returned as soon as bytes do not match signature of any version
+func detectProxyVersion(r *bufio.Reader) (int, error) {
+	for n := 1; n <= len(proxyV2Signature); n++ {
+		b, err := r.Peek(n)
+		if err != nil {
+			if err == io.EOF && n > 1 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		isV1 := n <= len(proxyV1Signature) && bytes.HasPrefix(proxyV1Signature, b)
+		isV2 := bytes.HasPrefix(proxyV2Signature, b)
+		switch {
+		case isV1 && n == len(proxyV1Signature):
+			return 1, nil
+		case isV2 && n == len(proxyV2Signature):
+			return 2, nil
+		case !isV1 && !isV2:
+			return 0, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// readProxyV1Header parses text header like "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n",
+// nil addresses are returned for "UNKNOWN" protocol
+func readProxyV1Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v1 header: %w", err)
+	}
+	if len(line) > maxProxyV1HeaderLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("invalid PROXY protocol v1 header: malformed line")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v1 header: %q", line)
+	}
+	srcAddr, err := parseProxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dstAddr, err := parseProxyV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return srcAddr, dstAddr, nil
+}
+
+func parseProxyV1Addr(host string, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header: bad address %q", host)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header: bad port %q", port)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(portNum)}, nil
+}
+
+// readProxyV2Header parses binary header, nil addresses are returned for LOCAL command
+// and for address families other than TCP over IPv4 and IPv6, TLVs are skipped
+func readProxyV2Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 header: %w", err)
+	}
+	verCmd, family := header[12], header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 header: %w", err)
+	}
+	if verCmd>>4 != 2 {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 header: unsupported version %d", verCmd>>4)
+	}
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL, i.e. health check of load balancer
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 header: unsupported command %d", verCmd&0x0f)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, errors.New("invalid PROXY protocol v2 header: short address block")
+	}
+	srcAddr := &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), payload[:ipLen]...)),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dstAddr := &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), payload[ipLen:2*ipLen]...)),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+
+	return srcAddr, dstAddr, nil
+}
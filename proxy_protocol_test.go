@@ -0,0 +1,36 @@
+package gopherpack
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProxyProtocolListenerKeepsReturningPermanentError(t *testing.T) {
+	p := newSingleProcessPack(0)
+	p.cfg.ProxyProtocol = ProxyProtocolOptional
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	// listener fails permanently, i.e. when it is closed behind wrapper
+	l.Close()
+	proxied := p.wrapWithProxyProtocol(l)
+
+	for i := 0; i < 3; i++ {
+		accepted := make(chan error, 1)
+		go func() {
+			_, err := proxied.Accept()
+			accepted <- err
+		}()
+		select {
+		case err := <-accepted:
+			if !errors.Is(err, net.ErrClosed) {
+				t.Errorf("accept %d returned %v, want %v", i, err, net.ErrClosed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("accept %d blocked after permanent error", i)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package gopherpack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+)
+
+// IsReady returns true if server of worker process is serving and did not start shutting down yet,
+// it is false during PreShutdownDelay so health checks of load balancers can route traffic away,
+// while worker process is unhealthy (see ReportUnhealthy) and while it is draining (see Drain)
+func IsReady() bool {
+	return defaultState.isReady()
+}
+
+// IsDraining returns true if worker process is draining
+func IsDraining() bool {
+	return defaultState.isDraining()
+}
+
+// Drain makes worker process not ready while it keeps serving existing and new connections,
+// unlike shutdown it does not stop the server, i.e. to take a canary out of rotation during progressive rollout
+func Drain() {
+	defaultState.setDraining(true)
+}
+
+// Undrain makes draining worker process ready again
+func Undrain() {
+	defaultState.setDraining(false)
+}
+
+// ReportUnhealthy makes worker process not ready (i.e. when backend dependency is down)
+// and tells main process the reason, it is reported by PackStatus of main process.
+// Only readiness endpoint fails while worker process is unhealthy, liveness endpoint keeps responding with 200
+func ReportUnhealthy(reason string) {
+	defaultPack().ReportUnhealthy(reason)
+}
+
+// ReportHealthy makes worker process ready again after ReportUnhealthy and tells main process about it
+func ReportHealthy() {
+	defaultPack().ReportHealthy()
+}
+
+// IsReady returns true if servers of the pack are ready, see package-level IsReady
+func (p *Pack) IsReady() bool {
+	return p.state.isReady()
+}
+
+// IsDraining returns true if servers of the pack are draining, see package-level IsDraining
+func (p *Pack) IsDraining() bool {
+	return p.state.isDraining()
+}
+
+// Drain makes servers of the pack not ready while they keep serving, see package-level Drain
+func (p *Pack) Drain() {
+	p.state.setDraining(true)
+}
+
+// Undrain makes draining servers of the pack ready again, see package-level Undrain
+func (p *Pack) Undrain() {
+	p.state.setDraining(false)
+}
+
+// ReportUnhealthy makes servers of the pack not ready and tells main process the reason, see package-level ReportUnhealthy
+func (p *Pack) ReportUnhealthy(reason string) {
+	atomic.StoreInt32(&p.state.unhealthy, 1)
+	p.notifyMainProcess(msgUnhealthy, reason)
+}
+
+// ReportHealthy makes servers of the pack ready again after ReportUnhealthy, see package-level ReportHealthy
+func (p *Pack) ReportHealthy() {
+	atomic.StoreInt32(&p.state.unhealthy, 0)
+	p.notifyMainProcess(msgHealthy, "")
+}
+
+func (s *packState) isReady() bool {
+	return s.isServing() && !s.isUnhealthy() && !s.isDraining()
+}
+
+func (s *packState) isUnhealthy() bool {
+	return atomic.LoadInt32(&s.unhealthy) == 1
+}
+
+// isServing returns true if server is serving and did not start shutting down regardless of its health
+func (s *packState) isServing() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+func (s *packState) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+func (s *packState) setDraining(isDraining bool) {
+	var value int32
+	if isDraining {
+		value = 1
+	}
+	atomic.StoreInt32(&s.draining, value)
+}
+
+func (s *packState) setReady(isReady bool) {
+	var value int32
+	if isReady {
+		value = 1
+	}
+	atomic.StoreInt32(&s.ready, value)
+}
+
+// markReady flips readiness flag and tells main process that worker process is ready to serve
+func (p *Pack) markReady() {
+	p.state.setReady(true)
+	// main process serving along with worker processes (see MainAlsoServes) has nobody to report to,
+	// and its signals are handled by main process loop
+	if p.isMainProcess() {
+		return
+	}
+	p.notifyMainProcess(msgReady, "")
+	if p.cfg.HeartbeatTimeout > 0 {
+		p.state.heartbeatOnce.Do(func() { go p.sendHeartbeats() })
+	}
+	if p.cfg.AcceptSkewInterval > 0 {
+		p.state.acceptReportOnce.Do(func() { go p.reportAccepts() })
+	}
+	if p.cfg.ResourceReportInterval > 0 {
+		p.state.resourceReportOnce.Do(func() { go p.reportResources() })
+	}
+	if p.cfg.WorkerMaxMemory > 0 {
+		p.state.memoryReportOnce.Do(func() { go p.reportMemory() })
+	}
+	if p.reloadsConfig() {
+		p.state.configReloadOnce.Do(func() { go p.handleConfigReloadSignals() })
+	}
+	if len(p.cfg.DrainSignals) > 0 || len(p.cfg.UndrainSignals) > 0 {
+		p.state.drainOnce.Do(func() { go p.handleDrainSignals() })
+	}
+}
+
+// handleDrainSignals flips draining flag of worker process when it receives DrainSignals or UndrainSignals
+func (p *Pack) handleDrainSignals() {
+	sigChan := make(chan os.Signal, 1)
+	if len(p.cfg.DrainSignals) > 0 {
+		signal.Notify(sigChan, p.cfg.DrainSignals...)
+	}
+	if len(p.cfg.UndrainSignals) > 0 {
+		signal.Notify(sigChan, p.cfg.UndrainSignals...)
+	}
+	for sig := range sigChan {
+		switch {
+		case containsSignal(p.cfg.DrainSignals, sig):
+			p.infof("Worker process PID=%d received signal: %s. Draining\n", pid, sig)
+			p.Drain()
+		case containsSignal(p.cfg.UndrainSignals, sig):
+			p.infof("Worker process PID=%d received signal: %s. Stop draining\n", pid, sig)
+			p.Undrain()
+		}
+	}
+}
+
+// sendHeartbeats periodically tells main process that worker process is alive,
+// heartbeat is skipped if OnHeartbeat hook returns error (or panics)
+func (p *Pack) sendHeartbeats() {
+	ticker := time.NewTicker(heartbeatInterval(p.cfg.HeartbeatTimeout))
+	defer ticker.Stop()
+	for range ticker.C {
+		if p.cfg.OnHeartbeat != nil {
+			heartbeatErr := errors.New("OnHeartbeat hook panicked")
+			p.callHook("OnHeartbeat", func() { heartbeatErr = p.cfg.OnHeartbeat() })
+			if heartbeatErr != nil {
+				p.warnf("Worker process PID=%d skipping heartbeat: %s\n", pid, heartbeatErr)
+				continue
+			}
+		}
+		p.notifyMainProcess(msgHeartbeat, "")
+	}
+}
+
+// heartbeatInterval returns how often heartbeats are sent so few of them fit into timeout
+func heartbeatInterval(timeout time.Duration) time.Duration {
+	return timeout / 3
+}
+
+// waitPackReady calls OnPackReady once all worker processes are ready, it is called with error wrapping
+// ErrPackNotReady if they are not ready within PackReadyTimeout, it is not called if main process stops before
+func (p *Pack) waitPackReady(workers *supervisor) {
+	var err error
+	if !workers.waitReady(p.cfg.PackReadyTimeout) {
+		if workers.isStopping() {
+			return
+		}
+		err = fmt.Errorf("%w: %d of %d are ready after %s",
+			ErrPackNotReady, workers.numReady(), len(workers.workers), p.cfg.PackReadyTimeout)
+		p.warnf("Main process PID=%d %s\n", pid, err)
+	} else {
+		p.infof("Main process PID=%d all worker processes are ready\n", pid)
+	}
+	p.callHook("OnPackReady", func() { p.cfg.OnPackReady(err) })
+}
@@ -0,0 +1,71 @@
+package gopherpack
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// reapOrphans reaps zombie processes adopted by main process running as PID 1 (i.e. in a container),
+// worker processes are not touched, they are reaped by supervise, and neither is new main process during upgrade.
+// Other children of main process (i.e. started with os/exec by hooks) can't be told apart from orphans,
+// so they are reaped too and waiting for them fails with ECHILD
+func (s *supervisor) reapOrphans() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGCHLD)
+	defer signal.Stop(sigChan)
+	for {
+		s.reapZombies()
+		select {
+		case <-sigChan:
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// reapZombies waits for exited children of main process which are not worker processes
+func (s *supervisor) reapZombies() {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		s.warnf("Main process PID=%d could not look for zombie processes: %s\n", pid, err)
+		return
+	}
+
+	// workers and new main process can't be forked or reaped meanwhile
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.waitedChildrenMu.Lock()
+	defer s.state.waitedChildrenMu.Unlock()
+	waitedPIDs := map[int]bool{}
+	for _, w := range s.workers {
+		if w.process != nil {
+			waitedPIDs[w.process.Pid] = true
+		}
+	}
+	for childPID := range s.state.waitedChildren {
+		waitedPIDs[childPID] = true
+	}
+	for _, entry := range entries {
+		childPID, err := strconv.Atoi(entry.Name())
+		if err != nil || waitedPIDs[childPID] {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// state and parent PID follow executable name in parentheses which can contain spaces
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) < 2 || fields[0] != "Z" || fields[1] != strconv.Itoa(pid) {
+			continue
+		}
+		var status syscall.WaitStatus
+		if reaped, err := syscall.Wait4(childPID, &status, syscall.WNOHANG, nil); err == nil && reaped == childPID {
+			s.debugf("Main process PID=%d reaped orphaned process PID=%d\n", pid, childPID)
+		}
+	}
+}
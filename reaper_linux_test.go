@@ -0,0 +1,47 @@
+package gopherpack
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startZombie starts child process which exits right away and waits until it becomes a zombie
+func startZombie(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("could not start child process: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(cmd.Process.Pid) + "/stat")
+		if err == nil && bytes.HasPrefix(bytes.TrimSpace(stat[bytes.LastIndexByte(stat, ')')+1:]), []byte("Z")) {
+			return cmd
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("child process did not exit")
+
+	return nil
+}
+
+func TestReapZombiesSkipsWaitedChildren(t *testing.T) {
+	p := newSingleProcessPack(0)
+	workers := newSupervisor(p, 1, []int{0}, nil)
+
+	waited := startZombie(t)
+	p.state.waitedChildren[waited.Process.Pid] = true
+	orphan := startZombie(t)
+	workers.reapZombies()
+
+	if err := waited.Wait(); err != nil {
+		t.Errorf("waiting for child process registered as waited failed: %v", err)
+	}
+	if err := orphan.Wait(); err == nil {
+		t.Error("zombie child process is not reaped")
+	}
+}
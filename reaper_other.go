@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package gopherpack
+
+// reapOrphans does nothing, main process is not expected to run as PID 1 on this platform
+func (s *supervisor) reapOrphans() {}
@@ -0,0 +1,128 @@
+package gopherpack
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dencoded/gopherpack/system"
+)
+
+// how often main process looks for worker processes to recycle
+const recycleCheckInterval = time.Second
+
+// monitorRecycling gracefully recycles worker processes which use more memory than WorkerMaxMemory,
+// served MaxRequests requests or run longer than WorkerMaxLifetime, one worker process at a time:
+// next one is recycled only after replacement of previous one is ready
+func (s *supervisor) monitorRecycling() {
+	ticker := time.NewTicker(recycleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stopChan:
+			return
+		}
+		if process, reason := s.pickWorkerToRecycle(); process != nil {
+			s.infof("Worker process PID=%d %s, recycling it\n", process.Pid, reason)
+			if err := process.Signal(s.shutdownSignal()); err != nil {
+				s.errorf("Could not send signal to worker process PID=%d. Error: %s\n", process.Pid, err)
+			}
+			if s.cfg.ForceKillTimeout > 0 {
+				go s.killIfRunning(process, s.cfg.ForceKillTimeout)
+			}
+		}
+	}
+}
+
+// pickWorkerToRecycle marks worker process using the most memory over WorkerMaxMemory (or the oldest one
+// which served MaxRequests requests, or the oldest one over WorkerMaxLifetime) as recycling and returns it
+// with the reason, nil is returned while any worker process is recycling or not ready yet so capacity drops
+// by one worker at most
+func (s *supervisor) pickWorkerToRecycle() (*os.Process, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		return nil, ""
+	}
+	var largest, served, oldest *worker
+	for _, w := range s.workers {
+		if w.recycling || (w.process != nil && !w.ready) {
+			return nil, ""
+		}
+		if w.process == nil || w.unresponsive {
+			continue
+		}
+		if s.cfg.WorkerMaxMemory > 0 && w.memory > uint64(s.cfg.WorkerMaxMemory) &&
+			(largest == nil || w.memory > largest.memory) {
+			largest = w
+		}
+		if w.servedMaxRequests && (served == nil || w.startedAt.Before(served.startedAt)) {
+			served = w
+		}
+		if s.cfg.WorkerMaxLifetime > 0 && time.Since(w.startedAt) >= s.cfg.WorkerMaxLifetime &&
+			(oldest == nil || w.startedAt.Before(oldest.startedAt)) {
+			oldest = w
+		}
+	}
+	switch {
+	case largest != nil:
+		largest.recycling = true
+		return largest.process, fmt.Sprintf("uses %d bytes of memory over limit of %d bytes",
+			largest.memory, s.cfg.WorkerMaxMemory)
+	case served != nil:
+		served.recycling = true
+		return served.process, fmt.Sprintf("served %d requests", s.cfg.MaxRequests)
+	case oldest != nil:
+		oldest.recycling = true
+		return oldest.process, fmt.Sprintf("reached maximum lifetime %s", s.cfg.WorkerMaxLifetime)
+	}
+
+	return nil, ""
+}
+
+// setServedMaxRequests marks worker process which served MaxRequests requests to be recycled in its turn
+func (s *supervisor) setServedMaxRequests(process *os.Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.servedMaxRequests = true
+			break
+		}
+	}
+}
+
+// reportMemory periodically tells main process resident memory of worker process, see WorkerMaxMemory
+func (p *Pack) reportMemory() {
+	ticker := time.NewTicker(p.cfg.MemoryCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		memory, err := system.ResidentMemory()
+		if err != nil {
+			p.warnf("Worker process PID=%d could not read its memory usage: %s\n", pid, err)
+			continue
+		}
+		p.notifyMainProcess(msgMemory, strconv.FormatUint(memory, 10))
+	}
+}
+
+// setMemory remembers memory usage reported by worker process
+func (s *supervisor) setMemory(process *os.Process, payload string) {
+	memory, err := strconv.ParseUint(payload, 10, 64)
+	if err != nil {
+		s.warnf("Main process PID=%d invalid memory usage from worker process PID=%d: %q\n",
+			pid, process.Pid, payload)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.memory = memory
+			break
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package gopherpack
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWorkersServedMaxRequestsAreRecycledOneAtATime(t *testing.T) {
+	p := newSingleProcessPack(0)
+	p.cfg.MaxRequests = 100
+	workers := newSupervisor(p, 2, []int{0}, nil)
+	for i, w := range workers.workers {
+		w.process = &os.Process{Pid: 1000 + i}
+		w.ready = true
+		w.startedAt = time.Now()
+		workers.setServedMaxRequests(w.process)
+	}
+
+	first, _ := workers.pickWorkerToRecycle()
+	if first == nil {
+		t.Fatal("worker process which served MaxRequests requests is not recycled")
+	}
+	if next, _ := workers.pickWorkerToRecycle(); next != nil {
+		t.Fatal("another worker process is recycled while first one is not replaced yet")
+	}
+
+	// replacement of first worker process is ready
+	for _, w := range workers.workers {
+		if w.process == first {
+			w.process = &os.Process{Pid: 2000}
+			w.recycling = false
+			w.servedMaxRequests = false
+		}
+	}
+	if next, _ := workers.pickWorkerToRecycle(); next == nil || next == first {
+		t.Errorf("second worker process is not recycled once first one is replaced")
+	}
+}
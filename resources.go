@@ -0,0 +1,43 @@
+package gopherpack
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/dencoded/gopherpack/system"
+)
+
+// reportResources periodically tells main process number of goroutines and open file descriptors of worker process,
+// -1 is reported for file descriptors if they can't be counted on this platform
+func (p *Pack) reportResources() {
+	ticker := time.NewTicker(p.cfg.ResourceReportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		openFiles, err := system.OpenFiles()
+		if err != nil {
+			openFiles = -1
+		}
+		p.notifyMainProcess(msgResources, fmt.Sprintf("%d %d", runtime.NumGoroutine(), openFiles))
+	}
+}
+
+// setResources remembers number of goroutines and open file descriptors reported by worker process
+func (s *supervisor) setResources(process *os.Process, payload string) {
+	var goroutines, openFiles int
+	if _, err := fmt.Sscanf(payload, "%d %d", &goroutines, &openFiles); err != nil {
+		s.warnf("Main process PID=%d invalid resource usage from worker process PID=%d: %q\n",
+			pid, process.Pid, payload)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.goroutines = goroutines
+			w.openFiles = openFiles
+			break
+		}
+	}
+}
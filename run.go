@@ -0,0 +1,84 @@
+package gopherpack
+
+import (
+	"context"
+	"os"
+)
+
+// ExitInfo tells how main process exited, see Run
+type ExitInfo struct {
+	// Signal is shutdown signal received by main process, nil if it exited for another reason
+	Signal os.Signal
+	// Clean is true if shutdown was requested (by signal, StopMainProcess or done context)
+	// and all worker processes exited without being killed after ForceKillTimeout
+	Clean bool
+	// Workers are last exit statuses of worker processes, one per each worker which has exited at least once
+	Workers []WorkerExit
+	// ForkErrors are errors of worker processes which could not be forked or restarted
+	ForkErrors []error
+
+	// shutdown was requested as opposed to main process giving up
+	requested bool
+}
+
+// WorkerExit is exit status of worker process
+type WorkerExit struct {
+	PID     int
+	CPUCore int
+	// Restarts is number of times in a row worker process was restarted before this exit, see Config.MaxRestarts
+	Restarts int
+	State    *os.ProcessState
+}
+
+// Run starts main process and forks worker processes as StartMainProcess does, it blocks until main process exits
+// and returns structured info about why it exited. Error is nil if shutdown was requested
+// by shutdown signal, StopMainProcess or done context, in this case ExitInfo tells if shutdown was clean
+func Run() (ExitInfo, error) {
+	return defaultPack().Run()
+}
+
+// RunContext is the same as Run but shutdown also starts when ctx is done
+func RunContext(ctx context.Context) (ExitInfo, error) {
+	return defaultPack().RunContext(ctx)
+}
+
+// Run starts main process using config of the pack, see package-level Run
+func (p *Pack) Run() (ExitInfo, error) {
+	return p.RunContext(context.Background())
+}
+
+// RunContext starts main process using config of the pack, see package-level RunContext
+func (p *Pack) RunContext(ctx context.Context) (ExitInfo, error) {
+	info, err := p.runMainProcess(ctx, nil, nil)
+	if info.requested {
+		return info, nil
+	}
+
+	return info, err
+}
+
+// exitInfo collects ExitInfo once main process is about to exit, sig is shutdown signal received (can be nil),
+// requested tells if shutdown was requested
+func (s *supervisor) exitInfo(sig os.Signal, requested bool) ExitInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := ExitInfo{
+		Signal:     sig,
+		Clean:      requested && !s.forceKilled,
+		ForkErrors: append([]error{}, s.forkErrs...),
+		requested:  requested,
+	}
+	for _, w := range s.workers {
+		if w.exitState != nil {
+			info.Workers = append(info.Workers, WorkerExit{
+				PID:      w.exitedPID,
+				CPUCore:  w.cpuCore,
+				Restarts: w.restarts,
+				State:    w.exitState,
+			})
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package gopherpack
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setBufferSizes sets SO_SNDBUF and SO_RCVBUF of a socket according to SendBufferSize and RecvBufferSize
+func (p *Pack) setBufferSizes(network, address string, fd uintptr) error {
+	if p.cfg.SendBufferSize > 0 {
+		if err := p.setBufferSize(network, address, fd, unix.SO_SNDBUF, unix.SO_SNDBUFFORCE, p.cfg.SendBufferSize); err != nil {
+			return err
+		}
+	}
+	if p.cfg.RecvBufferSize > 0 {
+		if err := p.setBufferSize(network, address, fd, unix.SO_RCVBUF, unix.SO_RCVBUFFORCE, p.cfg.RecvBufferSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setBufferSize tries to set buffer size above system limit first, which works for privileged process only
+func (p *Pack) setBufferSize(network, address string, fd uintptr, opt int, forceOpt int, size int) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, forceOpt, size); err != nil {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, opt, size); err != nil {
+			return err
+		}
+	}
+	// kernel doubles the size to leave room for its bookkeeping and reports doubled value
+	if actual, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, opt); err == nil && actual/2 < size {
+		p.warnf("Socket buffer size of %s/%s is clamped by kernel to %d bytes instead of %d\n", network, address, actual/2, size)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gopherpack
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setBufferSizes sets SO_SNDBUF and SO_RCVBUF of a socket according to SendBufferSize and RecvBufferSize
+func (p *Pack) setBufferSizes(network, address string, fd uintptr) error {
+	if p.cfg.SendBufferSize > 0 {
+		if err := p.setBufferSize(network, address, fd, unix.SO_SNDBUF, p.cfg.SendBufferSize); err != nil {
+			return err
+		}
+	}
+	if p.cfg.RecvBufferSize > 0 {
+		if err := p.setBufferSize(network, address, fd, unix.SO_RCVBUF, p.cfg.RecvBufferSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Pack) setBufferSize(network, address string, fd uintptr, opt int, size int) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, opt, size); err != nil {
+		return err
+	}
+	if actual, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, opt); err == nil && actual < size {
+		p.warnf("Socket buffer size of %s/%s is clamped by kernel to %d bytes instead of %d\n", network, address, actual, size)
+	}
+
+	return nil
+}
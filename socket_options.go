@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+package gopherpack
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketOptions is used as net.ListenConfig.Control to set SO_REUSEADDR and SO_REUSEPORT on a socket
+// (except unix socket)
+func (p *Pack) setSocketOptions(network, address string, c syscall.RawConn) error {
+	var err, reuseAddrErr, reusePortErr, v6OnlyErr, bufferErr, deviceErr, controlErr, returnErr error
+	err = c.Control(func(fd uintptr) {
+		// address reuse does not apply to unix sockets, they are bound to file path
+		if !isUnixNetwork(network) {
+			reuseAddrErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+			reusePortErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}
+		v6OnlyErr = p.setIPv6Only(network, fd)
+		bufferErr = p.setBufferSizes(network, address, fd)
+		deviceErr = p.bindToDevice(network, fd)
+		if p.cfg.SocketControl != nil {
+			controlErr = p.cfg.SocketControl(fd)
+		}
+	})
+
+	errMsg := []string{}
+	if err != nil {
+		errMsg = append(errMsg, err.Error())
+	}
+	if reuseAddrErr != nil {
+		errMsg = append(errMsg, reuseAddrErr.Error())
+	}
+	if reusePortErr != nil {
+		if p.cfg.StrictReusePort {
+			errMsg = append(errMsg, reusePortErr.Error())
+		} else {
+			p.warnf("Could not set SO_REUSEPORT on %s/%s: %s\n", network, address, reusePortErr)
+		}
+	}
+	if v6OnlyErr != nil {
+		errMsg = append(errMsg, v6OnlyErr.Error())
+	}
+	if bufferErr != nil {
+		errMsg = append(errMsg, bufferErr.Error())
+	}
+	if deviceErr != nil {
+		errMsg = append(errMsg, deviceErr.Error())
+	}
+	if controlErr != nil {
+		errMsg = append(errMsg, controlErr.Error())
+	}
+
+	if len(errMsg) > 0 {
+		returnErr = errors.New(strings.Join(errMsg, ";"))
+	}
+
+	return returnErr
+}
+
+// reusePortSupported tells if kernel supports SO_REUSEPORT by setting it on a probe socket
+func reusePortSupported() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+}
+
+// setIPv6Only sets IPV6_V6ONLY on IPv6 socket according to configured IPv6Mode
+func (p *Pack) setIPv6Only(network string, fd uintptr) error {
+	if p.cfg.IPv6Mode == IPv6Default || !strings.HasSuffix(network, "6") {
+		return nil
+	}
+	v6Only := 0
+	if p.cfg.IPv6Mode == IPv6Only {
+		v6Only = 1
+	}
+
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, v6Only)
+}
@@ -0,0 +1,100 @@
+//go:build windows
+// +build windows
+
+package gopherpack
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// setSocketOptions is used as net.ListenConfig.Control to set SO_REUSEADDR on a socket,
+// there is no SO_REUSEPORT on Windows
+func (p *Pack) setSocketOptions(network, address string, c syscall.RawConn) error {
+	var err, reuseAddrErr, v6OnlyErr, bufferErr, deviceErr, controlErr, returnErr error
+	err = c.Control(func(fd uintptr) {
+		if !isUnixNetwork(network) {
+			reuseAddrErr = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_REUSEADDR, 1)
+		}
+		v6OnlyErr = p.setIPv6Only(network, fd)
+		bufferErr = p.setBufferSizes(network, address, fd)
+		deviceErr = p.bindToDevice(network, fd)
+		if p.cfg.SocketControl != nil {
+			controlErr = p.cfg.SocketControl(fd)
+		}
+	})
+
+	errMsg := []string{}
+	if err != nil {
+		errMsg = append(errMsg, err.Error())
+	}
+	if reuseAddrErr != nil {
+		errMsg = append(errMsg, reuseAddrErr.Error())
+	}
+	if v6OnlyErr != nil {
+		errMsg = append(errMsg, v6OnlyErr.Error())
+	}
+	if bufferErr != nil {
+		errMsg = append(errMsg, bufferErr.Error())
+	}
+	if deviceErr != nil {
+		errMsg = append(errMsg, deviceErr.Error())
+	}
+	if controlErr != nil {
+		errMsg = append(errMsg, controlErr.Error())
+	}
+
+	if len(errMsg) > 0 {
+		returnErr = errors.New(strings.Join(errMsg, ";"))
+	}
+
+	return returnErr
+}
+
+// reusePortSupported returns error as there is no SO_REUSEPORT on Windows
+func reusePortSupported() error {
+	return errors.New("SO_REUSEPORT is not available on Windows")
+}
+
+// setIPv6Only sets IPV6_V6ONLY on IPv6 socket according to configured IPv6Mode
+func (p *Pack) setIPv6Only(network string, fd uintptr) error {
+	if p.cfg.IPv6Mode == IPv6Default || !strings.HasSuffix(network, "6") {
+		return nil
+	}
+	v6Only := 0
+	if p.cfg.IPv6Mode == IPv6Only {
+		v6Only = 1
+	}
+
+	return windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IPV6, windows.IPV6_V6ONLY, v6Only)
+}
+
+// setBufferSizes sets SO_SNDBUF and SO_RCVBUF of a socket according to SendBufferSize and RecvBufferSize
+func (p *Pack) setBufferSizes(network, address string, fd uintptr) error {
+	if p.cfg.SendBufferSize > 0 {
+		if err := p.setBufferSize(network, address, fd, windows.SO_SNDBUF, p.cfg.SendBufferSize); err != nil {
+			return err
+		}
+	}
+	if p.cfg.RecvBufferSize > 0 {
+		if err := p.setBufferSize(network, address, fd, windows.SO_RCVBUF, p.cfg.RecvBufferSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Pack) setBufferSize(network, address string, fd uintptr, opt int, size int) error {
+	if err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, opt, size); err != nil {
+		return err
+	}
+	if actual, err := windows.GetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, opt); err == nil && actual < size {
+		p.warnf("Socket buffer size of %s/%s is clamped to %d bytes instead of %d\n", network, address, actual, size)
+	}
+
+	return nil
+}
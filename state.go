@@ -0,0 +1,71 @@
+package gopherpack
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// packState is runtime state of servers of a pack in current process, each Pack returned by New has its own one,
+// package-level functions share defaultState. Resources passed by parent process (control channel, shared listener,
+// TLS session ticket key and sockets of systemd socket activation) are per process and are not part of it
+type packState struct {
+	// ready is set while server is serving and did not start shutting down, unhealthy is set while
+	// it reports it is degraded, draining is set while it keeps serving but asks load balancers to route new traffic away
+	ready     int32
+	unhealthy int32
+	draining  int32
+
+	// number of connections currently handled by TCP server
+	activeConnections int64
+	// number of bytes read from and written to connections of TCP server if CountBytes is set
+	bytesRead    int64
+	bytesWritten int64
+	// number of HTTP requests served if MaxRequests is set
+	servedRequests int64
+	// number of connections accepted by servers if AcceptSkewInterval is set
+	acceptedConnections int64
+
+	// certificate of TLS servers set by SetCertificate or loaded from TLSCertFile
+	currentCert atomic.Value
+
+	// address of listener of worker process
+	listenerAddrMu sync.Mutex
+	listenerAddr   net.Addr
+
+	// closed when worker process decides to exit to be replaced by new one
+	recycleChan chan struct{}
+	recycleOnce sync.Once
+
+	// supervisor of main process of the pack while it is running
+	supervisorMu sync.Mutex
+	supervisor   *supervisor
+
+	// PIDs of child processes of main process which are waited for outside of supervise
+	// (i.e. new main process during executable upgrade), orphan reaper does not reap them
+	waitedChildrenMu sync.Mutex
+	waitedChildren   map[int]bool
+
+	// drain and config reload signals are handled once per pack even if it runs several servers
+	drainOnce        sync.Once
+	configReloadOnce sync.Once
+
+	// heartbeats, accepted connections, resources and memory usage are reported once per pack
+	// even if it runs several servers
+	heartbeatOnce      sync.Once
+	acceptReportOnce   sync.Once
+	resourceReportOnce sync.Once
+	memoryReportOnce   sync.Once
+}
+
+// state of servers started by package-level functions
+var defaultState = newPackState()
+
+func newPackState() *packState {
+	return &packState{recycleChan: make(chan struct{}), waitedChildren: map[int]bool{}}
+}
+
+// defaultPack returns Pack used by package-level functions, it is configured with package-level settings
+func defaultPack() *Pack {
+	return newPack(DefaultConfig(), defaultState)
+}
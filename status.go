@@ -0,0 +1,93 @@
+package gopherpack
+
+import "time"
+
+// WorkerStatus describes worker process of the pack
+type WorkerStatus struct {
+	// PID is zero if worker process is not running
+	PID     int
+	CPUCore int
+	// StartedAt is time worker process was last started at
+	StartedAt time.Time
+	Restarts  int
+	Alive     bool
+	// Ready is true if worker process reported it is ready to serve
+	Ready bool
+	// Healthy is false if worker process reported it is degraded with ReportUnhealthy, UnhealthyReason is the reason
+	Healthy         bool
+	UnhealthyReason string
+	// Memory is resident memory of worker process in bytes as it reported last time if WorkerMaxMemory is set
+	Memory uint64
+	// Goroutines and OpenFiles are numbers of goroutines and open file descriptors of worker process
+	// as it reported last time if ResourceReportInterval is set (OpenFiles is -1 if it could not be counted),
+	// steady growth of them usually means leaking handlers
+	Goroutines int
+	OpenFiles  int
+}
+
+// Status describes state of the pack
+type Status struct {
+	MainPID int
+	Workers []WorkerStatus
+}
+
+// Healthy returns true if all running worker processes are healthy
+func (s Status) Healthy() bool {
+	for _, w := range s.Workers {
+		if w.Alive && !w.Healthy {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PackStatus returns state of worker processes of main process started by package-level functions,
+// Workers is empty if it is not a main process or main process is not started (or already returned)
+func PackStatus() Status {
+	return defaultPack().Status()
+}
+
+// Status returns state of worker processes of main process of the pack, see package-level PackStatus
+func (p *Pack) Status() Status {
+	s := p.state.runningSupervisor()
+	status := Status{MainPID: pid}
+	if s == nil {
+		return status
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		workerStatus := WorkerStatus{
+			CPUCore:   w.cpuCore,
+			StartedAt: w.startedAt,
+			Restarts:  w.restarts,
+			Alive:     w.process != nil,
+			Ready:     w.process != nil && w.ready,
+			Healthy:   !w.unhealthy,
+		}
+		if w.process != nil {
+			workerStatus.PID = w.process.Pid
+			workerStatus.UnhealthyReason = w.unhealthyReason
+			workerStatus.Memory = w.memory
+			workerStatus.Goroutines = w.goroutines
+			workerStatus.OpenFiles = w.openFiles
+		}
+		status.Workers = append(status.Workers, workerStatus)
+	}
+
+	return status
+}
+
+func (s *packState) setRunningSupervisor(workers *supervisor) {
+	s.supervisorMu.Lock()
+	s.supervisor = workers
+	s.supervisorMu.Unlock()
+}
+
+func (s *packState) runningSupervisor() *supervisor {
+	s.supervisorMu.Lock()
+	defer s.supervisorMu.Unlock()
+
+	return s.supervisor
+}
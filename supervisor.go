@@ -0,0 +1,717 @@
+package gopherpack
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dencoded/gopherpack/system"
+)
+
+// worker is a worker process controlled by main process
+type worker struct {
+	index   int
+	cpuCore int
+	// CPU cores worker process is placed on if it is not placed on single cpuCore (see Config.NUMAAffinity)
+	cpus     []int
+	process  *os.Process
+	restarts int
+	ready    bool
+	// time worker process was last started at
+	startedAt time.Time
+	// reason reported by unhealthy worker process
+	unhealthyReason string
+	unhealthy       bool
+	// last time heartbeat was received from ready worker process
+	lastHeartbeat time.Time
+	// worker process was asked to exit because of missing heartbeats
+	unresponsive bool
+	// worker process was asked to exit to be replaced by new one, its exit is not counted as restart
+	recycling bool
+	// worker process served MaxRequests requests and waits to be recycled
+	servedMaxRequests bool
+	// number of connections accepted by worker process as it reported last time and as of last skew check
+	accepted        int64
+	acceptedChecked int64
+	// resident memory of worker process in bytes as it reported last time, see Config.WorkerMaxMemory
+	memory uint64
+	// number of goroutines and open file descriptors of worker process as it reported last time
+	goroutines int
+	openFiles  int
+	// PID and exit status of last exited worker process, see ExitInfo
+	exitedPID int
+	exitState *os.ProcessState
+}
+
+// supervisor controls a set of worker processes of main process
+type supervisor struct {
+	*Pack
+
+	mu       sync.Mutex
+	workers  []*worker
+	stopping bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	// closed and replaced when any worker becomes ready, so every waiter gets notified
+	readyChan chan struct{}
+
+	// listener shared with workers if any
+	listenerFile *os.File
+
+	// CPU cores main process is allowed to run on
+	allowedCPUs []int
+
+	// errors of worker processes which could not be forked or restarted
+	forkErrs []error
+	// first error of setting affinity of worker process, wraps ErrAffinityDenied
+	affinityErr error
+	// some worker processes were killed as they did not exit within ForceKillTimeout
+	forceKilled bool
+
+	// TLS session ticket key shared with workers if any
+	ticketKey *[32]byte
+
+	// gets notified when worker asks for executable upgrade, see Config.OnConfigReload
+	upgradeRequests chan struct{}
+	// closed by StopMainProcess
+	stopRequests    chan struct{}
+	stopRequestOnce sync.Once
+}
+
+func newSupervisor(p *Pack, numWorkers int, cpus []int, listenerFile *os.File) *supervisor {
+	s := &supervisor{
+		Pack:         p,
+		allowedCPUs:  cpus,
+		listenerFile: listenerFile,
+		workers:      make([]*worker, numWorkers),
+		stopChan:     make(chan struct{}),
+		readyChan:    make(chan struct{}),
+
+		upgradeRequests: make(chan struct{}, 1),
+		stopRequests:    make(chan struct{}),
+	}
+	for i := range s.workers {
+		// wrap around CPU cores if there are more workers than cores
+		s.workers[i] = &worker{index: i, cpuCore: cpus[i%len(cpus)]}
+	}
+	if p.cfg.NUMAAffinity && !p.cfg.DisableAffinity {
+		s.placeOnNUMANodes()
+	}
+	if p.cfg.ShareTLSSessionTickets {
+		key, err := newTicketKey()
+		if err != nil {
+			s.warnf("Main process PID=%d could not generate TLS session ticket key: %s\n", pid, err)
+		}
+		s.ticketKey = key
+	}
+
+	return s
+}
+
+// placeOnNUMANodes distributes workers over NUMA nodes round-robin, each worker gets all CPU cores of its node
+// main process is allowed to run on (i.e. limited by cpuset of container), nodes without such cores are skipped
+func (s *supervisor) placeOnNUMANodes() {
+	allNodes, err := system.NUMANodes()
+	if err != nil {
+		s.warnf("Main process PID=%d could not read NUMA topology, placing worker processes on CPU cores: %s\n", pid, err)
+		return
+	}
+	allowed := map[int]bool{}
+	for _, cpuCore := range s.allowedCPUs {
+		allowed[cpuCore] = true
+	}
+	nodes := [][]int{}
+	for _, node := range allNodes {
+		allowedNode := []int{}
+		for _, cpuCore := range node {
+			if allowed[cpuCore] {
+				allowedNode = append(allowedNode, cpuCore)
+			}
+		}
+		if len(allowedNode) > 0 {
+			nodes = append(nodes, allowedNode)
+		}
+	}
+	if len(nodes) == 0 {
+		s.warnf("Main process PID=%d none of NUMA nodes has allowed CPU cores, placing worker processes on CPU cores\n", pid)
+		return
+	}
+	for i, w := range s.workers {
+		node := nodes[i%len(nodes)]
+		w.cpus = node
+		w.cpuCore = node[(i/len(nodes))%len(node)]
+	}
+}
+
+// placement returns CPU core (or comma separated CPU cores) worker process is placed on
+func (w *worker) placement() string {
+	if len(w.cpus) == 0 {
+		return strconv.Itoa(w.cpuCore)
+	}
+	cpus := make([]string, len(w.cpus))
+	for i, cpuCore := range w.cpus {
+		cpus[i] = strconv.Itoa(cpuCore)
+	}
+
+	return strings.Join(cpus, ",")
+}
+
+// start forks all worker processes and starts supervising them, returns number of started worker processes
+func (s *supervisor) start() int {
+	if s.cfg.HeartbeatTimeout > 0 {
+		go s.monitorHeartbeats()
+	}
+	if s.cfg.WorkerMaxLifetime > 0 || s.cfg.WorkerMaxMemory > 0 || s.cfg.MaxRequests > 0 {
+		go s.monitorRecycling()
+	}
+	if s.cfg.AcceptSkewInterval > 0 {
+		go s.monitorAcceptSkew()
+	}
+
+	// worker processes are forked one by one as affinity of main process is changed for each of them,
+	// ForkStagger spreads their initialization (i.e. warming caches) over time
+	started := 0
+	for i, w := range s.workers {
+		if i > 0 && s.cfg.ForkStagger > 0 {
+			time.Sleep(s.cfg.ForkStagger)
+		}
+		s.mu.Lock()
+		process, err := s.forkWorker(w)
+		if err != nil {
+			s.forkErrs = append(s.forkErrs, fmt.Errorf("could not start worker process on CPU core %d: %w", w.cpuCore, err))
+		}
+		s.mu.Unlock()
+		if err != nil {
+			s.errorf("Could not start worker process. Error: %s\n", err)
+			continue
+		}
+		started++
+		s.workerForked(process, w.cpuCore)
+		s.wg.Add(1)
+		go s.supervise(w)
+	}
+
+	return started
+}
+
+// setAffinity sets affinity of calling OS thread to the given CPU cores, tests replace it to make kernel deny affinity
+var setAffinity = func(cpus []int) error {
+	if len(cpus) == 1 {
+		return system.SetAffinity(cpus[0])
+	}
+
+	return system.SetAffinityMask(cpus)
+}
+
+// forkWorker forks worker process placed on worker's CPU core, must be called with s.mu held
+func (s *supervisor) forkWorker(w *worker) (*os.Process, error) {
+	// these env vars will make process to start worker part
+	envVals := []string{
+		fmt.Sprintf("%s=%d", envPPID, pid),          // to tell child that it is child
+		fmt.Sprintf("%s=%d", envCPUCore, w.cpuCore), // to tell child on which core it was placed
+	}
+	// worker process placed on CPU cores of NUMA node learns all of them, its cpuCore is the primary one
+	if len(w.cpus) > 0 {
+		envVals = append(envVals, fmt.Sprintf("%s=%s", envCPUSet, w.placement()))
+	}
+	// add env vars requested by client, gopherpack vars can't be overridden
+	if s.cfg.ExtraWorkerEnv != nil {
+		var extraEnv []string
+		s.callHook("ExtraWorkerEnv", func() { extraEnv = s.cfg.ExtraWorkerEnv(w.index) })
+		for _, envVar := range extraEnv {
+			if isGopherpackEnvVar(envVarName(envVar)) {
+				s.warnf("Ignoring extra env var %s of worker process, it is set by gopherpack\n", envVar)
+				continue
+			}
+			envVals = append(envVals, envVar)
+		}
+	}
+	extraFiles := []*os.File{}
+	// each worker process gets its own control channel, main process closes its end once worker process exits
+	controlConn, workerControlConn, err := newControlChannel()
+	if err != nil {
+		s.errorf("Main process PID=%d could not create control channel of worker process: %s\n", pid, err)
+	} else {
+		defer workerControlConn.Close()
+		envVals = append(envVals, fmt.Sprintf("%s=%d", envControlFD, extraFileFD(len(extraFiles))))
+		extraFiles = append(extraFiles, workerControlConn)
+	}
+	if s.listenerFile != nil {
+		envVals = append(envVals, fmt.Sprintf("%s=%d", envListenerFD, extraFileFD(len(extraFiles))))
+		extraFiles = append(extraFiles, s.listenerFile)
+	}
+	if s.ticketKey != nil {
+		if keyFile, err := ticketKeyFile(s.ticketKey); err != nil {
+			s.warnf("Main process PID=%d could not pass TLS session ticket key to worker process: %s\n", pid, err)
+		} else {
+			defer keyFile.Close()
+			envVals = append(envVals, fmt.Sprintf("%s=%d", envTLSTicketKeyFD, extraFileFD(len(extraFiles))))
+			extraFiles = append(extraFiles, keyFile)
+		}
+	}
+	// set affinity of main process on the fly so forked worker process will inherit it,
+	// affinity is an optimization so worker process still gets started if kernel denies it.
+	// Affinity is set for calling OS thread only, so goroutine stays on it until affinity is restored
+	if !s.cfg.DisableAffinity {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		cpus := w.cpus
+		if len(cpus) == 0 {
+			cpus = []int{w.cpuCore}
+		}
+		if err := setAffinity(cpus); err != nil {
+			s.warnf("Could not set affinity to CPU core %s, worker process will not be pinned: %s\n",
+				w.placement(),
+				err,
+			)
+			if s.affinityErr == nil {
+				s.affinityErr = fmt.Errorf("%w: CPU core %s: %w", ErrAffinityDenied, w.placement(), err)
+			}
+		}
+	}
+	// fork main process to start worker
+	process, err := s.forkProcess(false, envVals, extraFiles...)
+	// main process itself keeps running on all allowed CPU cores (and new main process inherits them during upgrade)
+	if !s.cfg.DisableAffinity {
+		if err := setAffinity(s.allowedCPUs); err != nil {
+			s.warnf("Main process PID=%d could not restore its affinity: %s\n", pid, err)
+		}
+	}
+	if err != nil {
+		if controlConn != nil {
+			controlConn.Close()
+		}
+		return nil, err
+	}
+	if controlConn != nil {
+		go s.readControl(process, controlConn)
+	}
+	w.process = process
+	w.startedAt = time.Now()
+	w.ready = false
+	w.unhealthy = false
+	w.unhealthyReason = ""
+	w.unresponsive = false
+	w.recycling = false
+	w.servedMaxRequests = false
+	w.accepted = 0
+	w.acceptedChecked = 0
+	w.memory = 0
+	w.goroutines = 0
+	w.openFiles = 0
+	s.infof("Worker process PID=%d started on CPU core %s\n", process.Pid, w.placement())
+
+	return process, nil
+}
+
+// workerForked calls a hook if needed after worker process started
+func (s *supervisor) workerForked(process *os.Process, cpuCore int) {
+	if s.cfg.OnWorkerForked != nil {
+		s.callHook("OnWorkerForked", func() { s.cfg.OnWorkerForked(process.Pid, cpuCore) })
+	}
+}
+
+// worker process running for this many RestartBackoff intervals (and at least for minStableUptime)
+// is considered stable, so its restarts are not counted against MaxRestarts anymore
+const (
+	stableUptimeBackoffs = 10
+	minStableUptime      = time.Minute
+)
+
+// stableUptime returns how long worker process has to run to be considered stable
+func stableUptime(restartBackoff time.Duration) time.Duration {
+	if uptime := stableUptimeBackoffs * restartBackoff; uptime > minStableUptime {
+		return uptime
+	}
+
+	return minStableUptime
+}
+
+// supervise reaps worker process and forks a replacement if it exited while pack is not stopping
+func (s *supervisor) supervise(w *worker) {
+	defer s.wg.Done()
+	for {
+		process := w.process
+		pState, err := process.Wait()
+		s.mu.Lock()
+		w.process = nil
+		// recycled worker process is replaced right away
+		recycled := w.recycling
+		s.mu.Unlock()
+		if err != nil {
+			s.errorf("Waiting failed for worker process PID=%d. Error: %s\n", process.Pid, err)
+			return
+		}
+		s.mu.Lock()
+		w.exitedPID = process.Pid
+		w.exitState = pState
+		// worker process which stayed up long enough is not crash looping, its next crash starts counting anew
+		if time.Since(w.startedAt) >= stableUptime(s.cfg.RestartBackoff) {
+			w.restarts = 0
+		}
+		s.mu.Unlock()
+		s.warnf("Worker process PID=%d exited with status: %s\n", process.Pid, pState)
+		if s.cfg.OnWorkerExited != nil {
+			s.callHook("OnWorkerExited", func() { s.cfg.OnWorkerExited(process.Pid, pState) })
+		}
+
+		// keep restarting worker until it starts or we run out of restarts
+		for {
+			if s.isStopping() {
+				return
+			}
+			if !recycled {
+				if s.cfg.MaxRestarts >= 0 && w.restarts >= s.cfg.MaxRestarts {
+					s.errorf("Worker process on CPU core %d reached maximum number of restarts: %d\n",
+						w.cpuCore,
+						s.cfg.MaxRestarts,
+					)
+					// let other worker processes to be recycled
+					s.mu.Lock()
+					w.recycling = false
+					s.mu.Unlock()
+					return
+				}
+				// give some time before restart to avoid crash loop
+				select {
+				case <-time.After(s.cfg.RestartBackoff):
+				case <-s.stopChan:
+					return
+				}
+			}
+
+			s.mu.Lock()
+			if s.stopping {
+				s.mu.Unlock()
+				return
+			}
+			if !recycled {
+				w.restarts++
+			}
+			recycled = false
+			restarted, err := s.forkWorker(w)
+			if err != nil {
+				s.forkErrs = append(s.forkErrs, fmt.Errorf("could not restart worker process on CPU core %d: %w", w.cpuCore, err))
+			}
+			s.mu.Unlock()
+			if err == nil {
+				s.workerForked(restarted, w.cpuCore)
+				break
+			}
+			s.errorf("Could not restart worker process on CPU core %d. Error: %s\n", w.cpuCore, err)
+		}
+	}
+}
+
+// forkErrors returns errors of all failed forks of worker processes and error of setting their affinity
+// joined together, nil if there were none
+func (s *supervisor) forkErrors() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := append([]error{}, s.forkErrs...)
+
+	return errors.Join(append(errs, s.affinityErr)...)
+}
+
+// pids returns PIDs of worker processes, zero PID is returned for a worker which is not running
+func (s *supervisor) pids() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pids := make([]int, len(s.workers))
+	for i, w := range s.workers {
+		if w.process != nil {
+			pids[i] = w.process.Pid
+		}
+	}
+
+	return pids
+}
+
+// readControl reads and handles messages sent by worker process via its control channel until it exits
+func (s *supervisor) readControl(process *os.Process, conn *os.File) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		msgType, payload, err := readControlMessage(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.warnf("Main process PID=%d could not read control channel of worker process PID=%d: %s\n",
+					pid, process.Pid, err)
+			}
+			return
+		}
+		switch msgType {
+		case msgReady:
+			s.setReady(process)
+		case msgHeartbeat:
+			s.setHeartbeat(process)
+		case msgUnhealthy:
+			s.setHealth(process, false, payload)
+		case msgHealthy:
+			s.setHealth(process, true, "")
+		case msgRecycle:
+			s.setRecycling(process)
+		case msgRequests:
+			s.setServedMaxRequests(process)
+		case msgAccepts:
+			s.setAccepted(process, payload)
+		case msgUpgrade:
+			s.requestUpgrade(process)
+		case msgMemory:
+			s.setMemory(process, payload)
+		case msgResources:
+			s.setResources(process, payload)
+		}
+	}
+}
+
+// setReady marks worker process as ready to serve
+func (s *supervisor) setReady(process *os.Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.ready = true
+			w.lastHeartbeat = time.Now()
+			s.debugf("Worker process PID=%d is ready\n", process.Pid)
+			break
+		}
+	}
+	close(s.readyChan)
+	s.readyChan = make(chan struct{})
+}
+
+// setRecycling marks worker process which is going to exit on its own to be replaced right away
+func (s *supervisor) setRecycling(process *os.Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.recycling = true
+			break
+		}
+	}
+}
+
+// setHeartbeat remembers time of last heartbeat of worker process
+func (s *supervisor) setHeartbeat(process *os.Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.lastHeartbeat = time.Now()
+			break
+		}
+	}
+}
+
+// setHealth remembers health reported by worker process
+func (s *supervisor) setHealth(process *os.Process, healthy bool, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.process == process {
+			w.unhealthy = !healthy
+			w.unhealthyReason = reason
+			if healthy {
+				s.infof("Worker process PID=%d is healthy\n", process.Pid)
+			} else {
+				s.warnf("Worker process PID=%d is unhealthy: %s\n", process.Pid, reason)
+			}
+			break
+		}
+	}
+}
+
+// monitorHeartbeats asks ready worker processes which stopped sending heartbeats to exit
+// (and kills them if they don't exit within HeartbeatTimeout), supervise restarts them then
+func (s *supervisor) monitorHeartbeats() {
+	ticker := time.NewTicker(heartbeatInterval(s.cfg.HeartbeatTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stopChan:
+			return
+		}
+		s.mu.Lock()
+		stale := []*os.Process{}
+		for _, w := range s.workers {
+			if w.process == nil || !w.ready || w.unresponsive || time.Since(w.lastHeartbeat) <= s.cfg.HeartbeatTimeout {
+				continue
+			}
+			w.unresponsive = true
+			stale = append(stale, w.process)
+		}
+		s.mu.Unlock()
+
+		for _, process := range stale {
+			s.warnf("Worker process PID=%d has not sent heartbeat within %s, terminating it\n",
+				process.Pid,
+				s.cfg.HeartbeatTimeout,
+			)
+			if err := process.Signal(s.shutdownSignal()); err != nil {
+				s.errorf("Could not send signal to worker process PID=%d. Error: %s\n", process.Pid, err)
+			}
+			go s.killIfRunning(process, s.cfg.HeartbeatTimeout)
+		}
+	}
+}
+
+// killIfRunning kills worker process if it did not exit within timeout
+func (s *supervisor) killIfRunning(process *os.Process, timeout time.Duration) {
+	time.Sleep(timeout)
+	s.mu.Lock()
+	running := false
+	for _, w := range s.workers {
+		if w.process == process {
+			running = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !running {
+		return
+	}
+	s.warnf("Worker process PID=%d did not exit within %s, killing it\n", process.Pid, timeout)
+	if err := process.Kill(); err != nil {
+		s.errorf("Could not kill worker process PID=%d. Error: %s\n", process.Pid, err)
+	}
+}
+
+// isReady returns true if there are running workers and all of them are ready
+func (s *supervisor) isReady() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isReadyLocked()
+}
+
+// isReadyLocked is the same as isReady, must be called with s.mu held
+func (s *supervisor) isReadyLocked() bool {
+	running := 0
+	for _, w := range s.workers {
+		if w.process == nil {
+			continue
+		}
+		if !w.ready {
+			return false
+		}
+		running++
+	}
+
+	return running > 0
+}
+
+// numReady returns number of ready workers
+func (s *supervisor) numReady() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ready := 0
+	for _, w := range s.workers {
+		if w.process != nil && w.ready {
+			ready++
+		}
+	}
+
+	return ready
+}
+
+// waitReady waits until all running workers are ready, returns false if timeout elapsed
+func (s *supervisor) waitReady(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		ready, readyChan := s.isReadyLocked(), s.readyChan
+		s.mu.Unlock()
+		if ready {
+			return true
+		}
+		select {
+		case <-readyChan:
+		case <-timer.C:
+			return false
+		case <-s.stopChan:
+			return false
+		}
+	}
+}
+
+// requestStop makes main process loop to stop workers and exit
+func (s *supervisor) requestStop() {
+	s.stopRequestOnce.Do(func() { close(s.stopRequests) })
+}
+
+func (s *supervisor) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stopping
+}
+
+// runningProcesses returns processes of running workers
+func (s *supervisor) runningProcesses() []*os.Process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	processes := []*os.Process{}
+	for _, w := range s.workers {
+		if w.process != nil {
+			processes = append(processes, w.process)
+		}
+	}
+
+	return processes
+}
+
+// stop propagates signal to all running workers and waits until they are done
+func (s *supervisor) stop(sig os.Signal) {
+	s.mu.Lock()
+	s.stopping = true
+	close(s.stopChan)
+	s.mu.Unlock()
+
+	for _, process := range s.runningProcesses() {
+		if err := process.Signal(sig); err != nil {
+			s.errorf("Could not send signal %s to worker process PID=%d. Error: %s\n",
+				sig,
+				process.Pid,
+				err,
+			)
+		}
+	}
+	// wait for workers to exit, kill the ones which are still running after ForceKillTimeout
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if s.cfg.ForceKillTimeout > 0 {
+		timeout = time.After(s.cfg.ForceKillTimeout)
+	}
+	select {
+	case <-done:
+		return
+	case <-timeout:
+	}
+	s.mu.Lock()
+	s.forceKilled = true
+	s.mu.Unlock()
+	for _, process := range s.runningProcesses() {
+		s.warnf("Worker process PID=%d did not exit within %s, killing it\n", process.Pid, s.cfg.ForceKillTimeout)
+		if err := process.Kill(); err != nil {
+			s.errorf("Could not kill worker process PID=%d. Error: %s\n", process.Pid, err)
+		}
+	}
+	<-done
+}
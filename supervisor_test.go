@@ -0,0 +1,158 @@
+package gopherpack
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newTestPack returns Pack which forks sleep processes as worker processes
+func newTestPack(t *testing.T) *Pack {
+	t.Helper()
+	if !preforkSupported {
+		t.Skip("main process is not supported on this platform")
+	}
+	sleepPath, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep executable is not found")
+	}
+	cfg := DefaultConfig()
+	cfg.Logger = log.New(io.Discard, "", 0)
+	cfg.ExecutablePath = sleepPath
+	cfg.ExecutableArgs = []string{"sleep", "30"}
+	cfg.MaxRestarts = 0
+
+	return New(cfg)
+}
+
+// stubAffinity replaces setAffinity with a function returning err until test is done,
+// returned counter tells how many times affinity was set
+func stubAffinity(t *testing.T, err error) *int {
+	t.Helper()
+	calls := new(int)
+	prevSetAffinity := setAffinity
+	setAffinity = func([]int) error {
+		*calls++
+		return err
+	}
+	t.Cleanup(func() { setAffinity = prevSetAffinity })
+
+	return calls
+}
+
+func TestForkWorkerAffinityDenied(t *testing.T) {
+	p := newTestPack(t)
+	denied := errors.New("operation not permitted")
+	stubAffinity(t, denied)
+
+	workers := newSupervisor(p, 2, []int{0}, nil)
+	started := workers.start()
+	defer workers.stop(syscall.SIGTERM)
+
+	if started != 2 {
+		t.Fatalf("started %d worker processes, want 2", started)
+	}
+	for i, workerPID := range workers.pids() {
+		if workerPID == 0 {
+			t.Errorf("worker process %d is not running", i)
+		}
+	}
+	err := workers.forkErrors()
+	if !errors.Is(err, ErrAffinityDenied) {
+		t.Errorf("fork errors %v do not wrap ErrAffinityDenied", err)
+	}
+	if !errors.Is(err, denied) {
+		t.Errorf("fork errors %v do not wrap error of setting affinity", err)
+	}
+}
+
+func TestForkWorkerAffinityDisabled(t *testing.T) {
+	p := newTestPack(t)
+	p.cfg.DisableAffinity = true
+	calls := stubAffinity(t, errors.New("operation not permitted"))
+
+	workers := newSupervisor(p, 2, []int{0}, nil)
+	started := workers.start()
+	defer workers.stop(syscall.SIGTERM)
+
+	if started != 2 {
+		t.Fatalf("started %d worker processes, want 2", started)
+	}
+	if *calls != 0 {
+		t.Errorf("affinity was set %d times, want none", *calls)
+	}
+	if err := workers.forkErrors(); err != nil {
+		t.Errorf("unexpected fork errors: %v", err)
+	}
+}
+
+func TestStartForksWorkerCount(t *testing.T) {
+	p := newTestPack(t)
+	p.cfg.WorkerCount = 3
+	stubAffinity(t, nil)
+	var forkedCores []int
+	p.cfg.OnWorkerForked = func(pid int, cpuCore int) { forkedCores = append(forkedCores, cpuCore) }
+
+	cpus := []int{0, 1}
+	numWorkers := p.workerCount(cpus, false)
+	if numWorkers != 3 {
+		t.Fatalf("worker count is %d, want 3", numWorkers)
+	}
+	workers := newSupervisor(p, numWorkers, cpus, nil)
+	started := workers.start()
+	defer workers.stop(syscall.SIGTERM)
+
+	if started != 3 || len(forkedCores) != 3 {
+		t.Fatalf("started %d and forked %d worker processes, want 3", started, len(forkedCores))
+	}
+	// CPU cores wrap around if there are more worker processes than cores
+	for i, cpuCore := range forkedCores {
+		if cpuCore != cpus[i%len(cpus)] {
+			t.Errorf("worker process %d is placed on CPU core %d, want %d", i, cpuCore, cpus[i%len(cpus)])
+		}
+	}
+}
+
+func TestWorkerCountDefaultsToAllowedCPUs(t *testing.T) {
+	p := newTestPack(t)
+	p.cfg.WorkerCount = 0
+	p.cfg.IgnoreCPUQuota = true
+
+	if numWorkers := p.workerCount([]int{0, 1, 2, 3}, false); numWorkers != 4 {
+		t.Errorf("worker count is %d, want 4", numWorkers)
+	}
+}
+
+func TestSuperviseResetsRestartsOfStableWorker(t *testing.T) {
+	p := newTestPack(t)
+	p.cfg.MaxRestarts = 1
+	p.cfg.RestartBackoff = 10 * time.Millisecond
+	stubAffinity(t, nil)
+	workers := newSupervisor(p, 1, []int{0}, nil)
+	if started := workers.start(); started != 1 {
+		t.Fatalf("started %d worker processes, want 1", started)
+	}
+	defer workers.stop(syscall.SIGTERM)
+
+	// worker process used its restarts up long ago and has been running stable since
+	workers.mu.Lock()
+	w := workers.workers[0]
+	w.restarts = p.cfg.MaxRestarts
+	w.startedAt = time.Now().Add(-2 * minStableUptime)
+	crashed := w.process
+	workers.mu.Unlock()
+	crashed.Kill()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if pids := workers.pids(); pids[0] != 0 && pids[0] != crashed.Pid {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("stable worker process is not restarted after crash")
+}
@@ -1,7 +1,18 @@
+//go:build darwin
 // +build darwin
 
 package system
 
+// AffinitySupported tells if CPU affinity of processes can be set on this platform
+const AffinitySupported = false
+
+// SetAffinity is a no-op on Mac OS as CPU-affinity API is not exposed there,
+// processes get placed on CPU cores by OS
 func SetAffinity(cpuCore int) error {
 	return nil
 }
+
+// SetAffinityMask is a no-op on Mac OS as CPU-affinity API is not exposed there
+func SetAffinityMask(cpus []int) error {
+	return nil
+}
@@ -1,11 +1,26 @@
+//go:build aix || dragonfly || freebsd || linux || netbsd || openbsd || solaris
 // +build aix dragonfly freebsd linux netbsd openbsd solaris
 
 package system
 
 import "golang.org/x/sys/unix"
 
+// AffinitySupported tells if CPU affinity of processes can be set on this platform
+const AffinitySupported = true
+
+// SetAffinity sets affinity of calling OS thread to the given CPU core, processes forked from it inherit it,
+// so caller should lock goroutine to OS thread (see runtime.LockOSThread)
 func SetAffinity(cpuCore int) error {
 	cpu := &unix.CPUSet{}
 	cpu.Set(cpuCore)
 	return unix.SchedSetaffinity(0, cpu)
 }
+
+// SetAffinityMask sets affinity of calling OS thread to the given set of CPU cores (i.e. SMT siblings or NUMA node)
+func SetAffinityMask(cpus []int) error {
+	cpuSet := &unix.CPUSet{}
+	for _, cpuCore := range cpus {
+		cpuSet.Set(cpuCore)
+	}
+	return unix.SchedSetaffinity(0, cpuSet)
+}
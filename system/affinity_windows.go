@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package system
+
+import "golang.org/x/sys/windows"
+
+// AffinitySupported tells if CPU affinity of processes can be set on this platform
+const AffinitySupported = true
+
+var procSetProcessAffinityMask = windows.NewLazySystemDLL("kernel32.dll").NewProc("SetProcessAffinityMask")
+
+// SetAffinity sets affinity of current process to the given CPU core
+func SetAffinity(cpuCore int) error {
+	return setProcessAffinityMask(uintptr(1) << uint(cpuCore))
+}
+
+// SetAffinityMask sets affinity of current process to the given set of CPU cores
+func SetAffinityMask(cpus []int) error {
+	var mask uintptr
+	for _, cpuCore := range cpus {
+		mask |= uintptr(1) << uint(cpuCore)
+	}
+
+	return setProcessAffinityMask(mask)
+}
+
+func setProcessAffinityMask(mask uintptr) error {
+	process, err := windows.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	if r, _, err := procSetProcessAffinityMask.Call(uintptr(process), mask); r == 0 {
+		return err
+	}
+
+	return nil
+}
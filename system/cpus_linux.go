@@ -0,0 +1,112 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// AllowedCPUs returns CPU cores current process is allowed to run on (i.e. limited by cpuset of cgroup or by taskset)
+func AllowedCPUs() ([]int, error) {
+	cpuSet := &unix.CPUSet{}
+	if err := unix.SchedGetaffinity(0, cpuSet); err != nil {
+		return nil, err
+	}
+	cpus := []int{}
+	for cpuCore := 0; len(cpus) < cpuSet.Count(); cpuCore++ {
+		if cpuSet.IsSet(cpuCore) {
+			cpus = append(cpus, cpuCore)
+		}
+	}
+
+	return cpus, nil
+}
+
+// CPUQuota returns number of CPU cores current process can use according to CPU quota of its cgroup
+// (cpu.max of cgroup v2 or cpu.cfs_quota_us and cpu.cfs_period_us of cgroup v1), zero means no quota
+func CPUQuota() (float64, error) {
+	cgroupPaths, err := cgroupPaths()
+	if err != nil {
+		return 0, err
+	}
+
+	// cgroup v2
+	if cgroupPath, ok := cgroupPaths[""]; ok {
+		cpuMax, err := os.ReadFile(filepath.Join("/sys/fs/cgroup", cgroupPath, "cpu.max"))
+		if err == nil {
+			// format is "<quota> <period>" where quota is "max" if there is no limit
+			fields := strings.Fields(string(cpuMax))
+			if len(fields) != 2 || fields[0] == "max" {
+				return 0, nil
+			}
+			return quota(fields[0], fields[1])
+		}
+	}
+
+	// cgroup v1
+	if cgroupPath, ok := cgroupPaths["cpu"]; ok {
+		for _, dir := range []string{filepath.Join("/sys/fs/cgroup/cpu", cgroupPath), "/sys/fs/cgroup/cpu"} {
+			quotaUs, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+			if err != nil {
+				continue
+			}
+			periodUs, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+			if err != nil {
+				continue
+			}
+			return quota(strings.TrimSpace(string(quotaUs)), strings.TrimSpace(string(periodUs)))
+		}
+	}
+
+	return 0, nil
+}
+
+// cgroupPaths returns cgroup path of current process per controller read from /proc/self/cgroup,
+// path of cgroup v2 unified hierarchy has empty controller
+func cgroupPaths() (map[string]string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// format is "<hierarchy ID>:<controllers>:<path>"
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	return paths, scanner.Err()
+}
+
+// quota returns number of CPU cores for quota and period given in microseconds, negative quota means no limit
+func quota(quotaUs string, periodUs string) (float64, error) {
+	quota, err := strconv.ParseFloat(quotaUs, 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseFloat(periodUs, 64)
+	if err != nil {
+		return 0, err
+	}
+	if quota <= 0 {
+		return 0, nil
+	}
+	if period <= 0 {
+		return 0, errors.New("malformed CPU quota period")
+	}
+
+	return quota / period, nil
+}
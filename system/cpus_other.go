@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package system
+
+import "runtime"
+
+// AllowedCPUs returns CPU cores current process can run on, all CPU cores are reported on this platform
+func AllowedCPUs() ([]int, error) {
+	cpus := make([]int, runtime.NumCPU())
+	for i := range cpus {
+		cpus[i] = i
+	}
+
+	return cpus, nil
+}
+
+// CPUQuota always reports no quota on this platform
+func CPUQuota() (float64, error) {
+	return 0, nil
+}
@@ -0,0 +1,14 @@
+package system
+
+import "os"
+
+// OpenFiles returns number of file descriptors open by current process read from /proc/self/fd
+func OpenFiles() (int, error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+
+	// descriptor used to read the directory itself is not counted
+	return len(entries) - 1, nil
+}
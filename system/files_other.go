@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package system
+
+import "os"
+
+// OpenFiles returns number of file descriptors open by current process read from /dev/fd,
+// error is returned on platforms without it (i.e. Windows)
+func OpenFiles() (int, error) {
+	entries, err := os.ReadDir("/dev/fd")
+	if err != nil {
+		return 0, err
+	}
+
+	// descriptor used to read the directory itself is not counted
+	return len(entries) - 1, nil
+}
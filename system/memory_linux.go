@@ -0,0 +1,27 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ResidentMemory returns resident set size of current process in bytes read from /proc/self/statm
+func ResidentMemory() (uint64, error) {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	// format is "<size> <resident> <shared> ..." in pages
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, errors.New("malformed /proc/self/statm")
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return pages * uint64(os.Getpagesize()), nil
+}
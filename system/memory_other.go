@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package system
+
+import "runtime"
+
+// ResidentMemory returns memory obtained by Go runtime from OS in bytes,
+// it approximates resident set size of current process on this platform
+func ResidentMemory() (uint64, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return stats.Sys, nil
+}
@@ -0,0 +1,75 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NUMANodes returns CPU cores of each NUMA node read from /sys/devices/system/node
+func NUMANodes() ([][]int, error) {
+	nodeDirs, err := filepath.Glob("/sys/devices/system/node/node[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	// keep nodes ordered by their number
+	sort.Slice(nodeDirs, func(i, j int) bool {
+		return nodeNumber(nodeDirs[i]) < nodeNumber(nodeDirs[j])
+	})
+
+	nodes := [][]int{}
+	for _, nodeDir := range nodeDirs {
+		cpuList, err := os.ReadFile(filepath.Join(nodeDir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := parseCPUList(strings.TrimSpace(string(cpuList)))
+		if err != nil {
+			return nil, err
+		}
+		// node can have no CPU cores (i.e. memory only node)
+		if len(cpus) > 0 {
+			nodes = append(nodes, cpus)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no NUMA nodes found")
+	}
+
+	return nodes, nil
+}
+
+func nodeNumber(nodeDir string) int {
+	number, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(nodeDir), "node"))
+	return number
+}
+
+// parseCPUList parses list of CPU cores in kernel format, i.e. "0-3,8-11"
+func parseCPUList(cpuList string) ([]int, error) {
+	cpus := []int{}
+	if cpuList == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(cpuList, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("malformed CPU list %q", cpuList)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("malformed CPU list %q", cpuList)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
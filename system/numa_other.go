@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package system
+
+import "errors"
+
+// NUMANodes is not supported on this platform
+func NUMANodes() ([][]int, error) {
+	return nil, errors.New("NUMA topology is not available on this platform")
+}
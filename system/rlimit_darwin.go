@@ -0,0 +1,31 @@
+//go:build darwin
+// +build darwin
+
+package system
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// RaiseFileLimit sets current limit of file descriptors to its maximum,
+// returns limit values before and after update.
+// Mac OS rejects limit above kern.maxfilesperproc (i.e. when maximum is RLIM_INFINITY)
+// so limit gets capped with it
+func RaiseFileLimit() (uint64, uint64, error) {
+	var rLimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+		return 0, 0, err
+	}
+	prevCur := rLimit.Cur
+	rLimit.Cur = rLimit.Max
+	if maxFilesPerProc, err := unix.SysctlUint32("kern.maxfilesperproc"); err == nil && rLimit.Cur > uint64(maxFilesPerProc) {
+		rLimit.Cur = uint64(maxFilesPerProc)
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+		return prevCur, prevCur, err
+	}
+
+	return prevCur, rLimit.Cur, nil
+}
@@ -0,0 +1,22 @@
+//go:build aix || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix dragonfly freebsd linux netbsd openbsd solaris
+
+package system
+
+import "syscall"
+
+// RaiseFileLimit sets current limit of file descriptors to its maximum,
+// returns limit values before and after update
+func RaiseFileLimit() (uint64, uint64, error) {
+	var rLimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+		return 0, 0, err
+	}
+	prevCur := uint64(rLimit.Cur)
+	rLimit.Cur = rLimit.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+		return prevCur, prevCur, err
+	}
+
+	return prevCur, uint64(rLimit.Cur), nil
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package system
+
+// RaiseFileLimit is a no-op on Windows as there is no RLIMIT_NOFILE there
+func RaiseFileLimit() (uint64, uint64, error) {
+	return 0, 0, nil
+}
@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+package gopherpack
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// first file descriptor passed by systemd socket activation (SD_LISTEN_FDS_START)
+const systemdListenFDsStart = 3
+
+// sockets passed by systemd socket activation (see sd_listen_fds(3)), env vars of socket activation
+// are removed once sockets are taken so worker processes and new main process do not look for them
+var (
+	systemdSocketsMu sync.Mutex
+	systemdSockets   = takeSystemdSockets()
+)
+
+func takeSystemdSockets() []*os.File {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	numFDs, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || numFDs <= 0 {
+		return nil
+	}
+
+	files := make([]*os.File, 0, numFDs)
+	for i := 0; i < numFDs; i++ {
+		fd := systemdListenFDsStart + i
+		// sockets are passed to worker processes explicitly if needed
+		syscall.CloseOnExec(fd)
+		name := "systemd-socket"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+
+	return files
+}
+
+// takeSystemdSocket returns socket passed by systemd socket activation which is bound to network and address,
+// nil is returned if there is no such socket, each socket is returned once
+func (p *Pack) takeSystemdSocket(network string, address string, packet bool) *os.File {
+	systemdSocketsMu.Lock()
+	defer systemdSocketsMu.Unlock()
+
+	for i, file := range systemdSockets {
+		if !systemdSocketMatches(int(file.Fd()), network, address, packet) {
+			continue
+		}
+		systemdSockets = append(systemdSockets[:i], systemdSockets[i+1:]...)
+		p.infof("Using socket %s passed by systemd for %s/%s\n", file.Name(), network, address)
+		return file
+	}
+
+	return nil
+}
+
+// systemdSocketMatches tells if socket is of the needed type and bound to network and address,
+// host of address is ignored if it is not an IP address
+func systemdSocketMatches(fd int, network string, address string, packet bool) bool {
+	sockType, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil || (sockType == syscall.SOCK_DGRAM) != packet {
+		return false
+	}
+	sockAddr, err := syscall.Getsockname(fd)
+	if err != nil {
+		return false
+	}
+
+	if isUnixNetwork(network) {
+		unixAddr, ok := sockAddr.(*syscall.SockaddrUnix)
+		return ok && unixAddr.Name == address
+	}
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	port, err := net.LookupPort(network, portStr)
+	if err != nil {
+		return false
+	}
+	var sockIP net.IP
+	switch sa := sockAddr.(type) {
+	case *syscall.SockaddrInet4:
+		if sa.Port != port {
+			return false
+		}
+		sockIP = net.IP(sa.Addr[:])
+	case *syscall.SockaddrInet6:
+		if sa.Port != port {
+			return false
+		}
+		sockIP = net.IP(sa.Addr[:])
+	default:
+		return false
+	}
+	ip := net.ParseIP(host)
+
+	return ip == nil || ip.IsUnspecified() || ip.Equal(sockIP)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package gopherpack
+
+import "os"
+
+// takeSystemdSocket returns nil, systemd socket activation is not supported on this platform
+func (p *Pack) takeSystemdSocket(network string, address string, packet bool) *os.File {
+	return nil
+}
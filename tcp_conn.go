@@ -0,0 +1,191 @@
+package gopherpack
+
+import (
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// tcpOptionsListener applies connection options of the pack to accepted connections
+type tcpOptionsListener struct {
+	net.Listener
+	p *Pack
+}
+
+func (l *tcpOptionsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.p.setConnOptions(conn), nil
+}
+
+// wrapWithConnOptions wraps listener of TCP server if any connection options are configured
+func (p *Pack) wrapWithConnOptions(l net.Listener) net.Listener {
+	if p.cfg.TCPKeepAlive == 0 && p.cfg.TCPLinger == 0 && p.cfg.TCPReadTimeout <= 0 && p.cfg.TCPWriteTimeout <= 0 &&
+		!p.cfg.CountBytes && p.cfg.TCPNoDelay {
+		return l
+	}
+
+	return &tcpOptionsListener{Listener: l, p: p}
+}
+
+// setConnOptions sets keepalive, linger and TCP_NODELAY of accepted connection and wraps it to apply read/write timeouts
+func (p *Pack) setConnOptions(conn net.Conn) net.Conn {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		var err error
+		if p.cfg.TCPKeepAlive > 0 {
+			if err = tcpConn.SetKeepAlive(true); err == nil {
+				err = tcpConn.SetKeepAlivePeriod(p.cfg.TCPKeepAlive)
+			}
+		} else if p.cfg.TCPKeepAlive < 0 {
+			err = tcpConn.SetKeepAlive(false)
+		}
+		if err != nil {
+			p.warnf("Worker process PID=%d could not set keepalive of connection: %s\n", pid, err)
+		}
+		if p.cfg.TCPLinger > 0 {
+			err = tcpConn.SetLinger(p.cfg.TCPLinger)
+		} else if p.cfg.TCPLinger < 0 {
+			err = tcpConn.SetLinger(0)
+		}
+		if err != nil {
+			p.warnf("Worker process PID=%d could not set linger of connection: %s\n", pid, err)
+		}
+		// Go sets TCP_NODELAY on accepted connections already
+		if !p.cfg.TCPNoDelay {
+			if err := tcpConn.SetNoDelay(false); err != nil {
+				p.warnf("Worker process PID=%d could not unset TCP_NODELAY of connection: %s\n", pid, err)
+			}
+		}
+	}
+	if p.cfg.CountBytes {
+		conn = &countingConn{Conn: conn, state: p.state}
+	}
+	if p.cfg.TCPReadTimeout <= 0 && p.cfg.TCPWriteTimeout <= 0 {
+		return conn
+	}
+
+	return &deadlineConn{
+		Conn:         conn,
+		readTimeout:  p.cfg.TCPReadTimeout,
+		writeTimeout: p.cfg.TCPWriteTimeout,
+	}
+}
+
+// countingConn adds bytes read and written to counters of worker process,
+// it wraps raw connection so TLS connection on top of it keeps its ConnectionState
+type countingConn struct {
+	net.Conn
+	state *packState
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.state.bytesRead, int64(n))
+
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.state.bytesWritten, int64(n))
+
+	return n, err
+}
+
+// NetConn returns wrapped connection (i.e. *net.TCPConn)
+func (c *countingConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// deadlineConn extends deadline of connection before each read and write unless caller has set its own deadline
+// (i.e. handler or TLS handshake within TLSHandshakeTimeout), extending is resumed once caller resets it to zero
+type deadlineConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// set while deadline set by caller is in effect
+	readDeadlineSet  int32
+	writeDeadlineSet int32
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 && atomic.LoadInt32(&c.readDeadlineSet) == 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 && atomic.LoadInt32(&c.writeDeadlineSet) == 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.Conn.Write(b)
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	setDeadlineFlag(&c.readDeadlineSet, t)
+	setDeadlineFlag(&c.writeDeadlineSet, t)
+
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	setDeadlineFlag(&c.readDeadlineSet, t)
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	setDeadlineFlag(&c.writeDeadlineSet, t)
+
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns raw connection (i.e. *net.TCPConn), countingConn is unwrapped too if CountBytes is set
+func (c *deadlineConn) NetConn() net.Conn {
+	if counting, ok := c.Conn.(*countingConn); ok {
+		return counting.NetConn()
+	}
+
+	return c.Conn
+}
+
+// setDeadlineFlag remembers whether caller has set deadline, zero time resets it
+func setDeadlineFlag(flag *int32, t time.Time) {
+	var value int32
+	if !t.IsZero() {
+		value = 1
+	}
+	atomic.StoreInt32(flag, value)
+}
+
+// completeHandshake does TLS handshake of connection within TLSHandshakeTimeout before it is passed to handler,
+// connection is closed and false is returned if handshake fails
+func (p *Pack) completeHandshake(conn net.Conn) bool {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok || p.cfg.TLSHandshakeTimeout <= 0 {
+		return true
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(p.cfg.TLSHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		if p.cfg.LogConnections {
+			p.debugf("TLS handshake with %s failed: %s\n", conn.RemoteAddr(), err)
+		}
+		tlsConn.Close()
+		return false
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return true
+}
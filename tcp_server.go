@@ -1,46 +1,295 @@
 package gopherpack
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// delay before accepting again after temporary error is doubled on each consecutive error (as net/http does)
+const (
+	minAcceptRetryDelay = 5 * time.Millisecond
+	maxAcceptRetryDelay = time.Second
+)
+
+// ActiveConnections returns number of connections currently handled by TCP server of worker process
+func ActiveConnections() int64 {
+	return atomic.LoadInt64(&defaultState.activeConnections)
+}
+
+// BytesRead returns number of bytes read from connections of TCP server of worker process if CountBytes is set
+func BytesRead() int64 {
+	return atomic.LoadInt64(&defaultState.bytesRead)
+}
+
+// BytesWritten returns number of bytes written to connections of TCP server of worker process if CountBytes is set
+func BytesWritten() int64 {
+	return atomic.LoadInt64(&defaultState.bytesWritten)
+}
+
+// ActiveConnections returns number of connections currently handled by TCP server of the pack,
+// see package-level ActiveConnections
+func (p *Pack) ActiveConnections() int64 {
+	return atomic.LoadInt64(&p.state.activeConnections)
+}
+
+// BytesRead returns number of bytes read from connections of TCP server of the pack, see package-level BytesRead
+func (p *Pack) BytesRead() int64 {
+	return atomic.LoadInt64(&p.state.bytesRead)
+}
+
+// BytesWritten returns number of bytes written to connections of TCP server of the pack, see package-level BytesWritten
+func (p *Pack) BytesWritten() int64 {
+	return atomic.LoadInt64(&p.state.bytesWritten)
+}
+
 // ListenAndServeTCP starts TCP server on specified network and address.
-// network parameter can be "tcp" or "unix"
-// TLS is supported by passing non nil tlsConfig
+// network parameter can be "tcp", "tcp4", "tcp6" or "unix"
+// TLS is supported by passing non nil tlsConfig (ALPN protocols are set by its NextProtos,
+// session tickets are resumable by any worker process if ShareTLSSessionTickets is set),
+// server uses a clone of tlsConfig, so caller keeps owning it and changes made after the call are not seen
 // handler parameter is a callback function called as Go-routine when new connection accepted
 func ListenAndServeTCP(network string, address string, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	return defaultPack().ListenAndServeTCP(network, address, tlsConfig, handler)
+}
+
+// ListenAndServeTCPContext is the same as ListenAndServeTCP but shutdown also starts when ctx is done
+func ListenAndServeTCPContext(ctx context.Context, network string, address string, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	return defaultPack().ListenAndServeTCPContext(ctx, network, address, tlsConfig, handler)
+}
+
+// ListenAndServeTCP starts TCP server using config of the pack, see package-level ListenAndServeTCP
+func (p *Pack) ListenAndServeTCP(network string, address string, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	return p.ListenAndServeTCPContext(context.Background(), network, address, tlsConfig, handler)
+}
+
+// ListenAndServeTCPContext starts TCP server using config of the pack, see package-level ListenAndServeTCPContext
+func (p *Pack) ListenAndServeTCPContext(ctx context.Context, network string, address string, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	if err := validateNetwork(network, false); err != nil {
+		return err
+	}
+
 	// check if we are in main process
-	if isMainProcess {
-		return StartMainProcess()
+	if p.isMainProcess() {
+		return p.startMainProcessWithListener(ctx, network, address, false, p.mainServer(network, address,
+			func(ctx context.Context, l net.Listener) error { return p.runTCPServer(ctx, l, tlsConfig, handler) }))
 	}
 
 	// setup runtime params
-	if err := setupWorkerRuntime(); err != nil {
+	if err := p.setupWorkerRuntime(); err != nil {
 		return err
 	}
 
 	// announce listener
-	l, err := getListenerWithSocketOptions(network, address)
+	l, err := p.getListenerWithSocketOptions(network, address)
 	if err != nil {
 		return err
 	}
+
+	return p.runTCPServer(ctx, l, tlsConfig, handler)
+}
+
+// ServeTCP starts TCP server on listener created by caller (i.e. passed by systemd socket activation),
+// main process shares this listener with worker processes, so l can be nil in worker processes
+// (see IsMainProcess), gopherpack socket options are not applied to it.
+// TLS is supported by passing non nil tlsConfig, it is cloned as ListenAndServeTCP does
+func ServeTCP(l net.Listener, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	return defaultPack().ServeTCP(l, tlsConfig, handler)
+}
+
+// ServeTCPContext is the same as ServeTCP but shutdown also starts when ctx is done
+func ServeTCPContext(ctx context.Context, l net.Listener, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	return defaultPack().ServeTCPContext(ctx, l, tlsConfig, handler)
+}
+
+// ServeTCP starts TCP server using config of the pack, see package-level ServeTCP
+func (p *Pack) ServeTCP(l net.Listener, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	return p.ServeTCPContext(context.Background(), l, tlsConfig, handler)
+}
+
+// ServeTCPContext starts TCP server using config of the pack, see package-level ServeTCPContext
+func (p *Pack) ServeTCPContext(ctx context.Context, l net.Listener, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	// check if we are in main process
+	if p.isMainProcess() {
+		return p.startMainProcessWithUserListener(ctx, l, p.mainServer("", "",
+			func(ctx context.Context, l net.Listener) error { return p.runTCPServer(ctx, l, tlsConfig, handler) }))
+	}
+
+	// setup runtime params
+	if err := p.setupWorkerRuntime(); err != nil {
+		return err
+	}
+
+	l, err := p.workerListener(l)
+	if err != nil {
+		return err
+	}
+
+	return p.runTCPServer(ctx, l, tlsConfig, handler)
+}
+
+// runTCPServer accepts connections on listener of worker process until shutdown signal is received
+func (p *Pack) runTCPServer(ctx context.Context, l net.Listener, tlsConfig *tls.Config, handler func(net.Conn)) error {
+	p.logServing("TCP", l.Addr())
 	defer l.Close()
+	l = p.wrapWithAcceptCounter(l)
+	l = p.wrapWithConnOptions(l)
+	l = p.wrapWithProxyProtocol(l)
 
-	// check if we need to do TLS
+	// check if we need to do TLS, config of caller is cloned so it can be shared with other servers
 	if tlsConfig != nil {
-		Logger.Println("Using TLS")
+		p.infof("Using TLS\n")
+		tlsConfig = tlsConfig.Clone()
+		setSessionTicketKeys(tlsConfig)
+		p.setCertificateGetter(tlsConfig)
 		l = tls.NewListener(l, tlsConfig)
 	}
 
+	// catch signals to do graceful shutdown
+	shutdown := p.watchShutdown(ctx)
+	defer shutdown.release()
+	shuttingDown := shutdown.started
+	go func() {
+		<-shuttingDown
+		// closing listener makes accept loop to stop
+		if err := l.Close(); err != nil {
+			p.warnf("Worker process PID=%d could not close listener: %s\n", pid, err)
+		}
+	}()
+
+	// tell main process we are ready to serve
+	p.markReady()
+
 	// start accept/handle connection loop
+	var handlers sync.WaitGroup
+	var handlerSlots chan struct{}
+	if p.cfg.MaxConcurrentHandlers > 0 {
+		handlerSlots = make(chan struct{}, p.cfg.MaxConcurrentHandlers)
+	}
+	var acceptRetryDelay time.Duration
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			Logger.Printf("Worker process PID=%d accept connection error: %s", pid, err)
+			// check if listener was closed because of shutdown
+			select {
+			case <-shuttingDown:
+				p.waitForHandlers(shutdown.ctx, &handlers)
+				return nil
+			default:
+			}
+			// retry on temporary errors, i.e. when running out of file descriptors, unless OnAcceptError decides otherwise
+			netErr, ok := err.(net.Error)
+			retry := ok && netErr.Temporary()
+			if p.cfg.OnAcceptError != nil {
+				p.callHook("OnAcceptError", func() { retry = p.cfg.OnAcceptError(err) })
+			}
+			if retry {
+				if acceptRetryDelay == 0 {
+					acceptRetryDelay = minAcceptRetryDelay
+				} else {
+					acceptRetryDelay *= 2
+				}
+				if acceptRetryDelay > maxAcceptRetryDelay {
+					acceptRetryDelay = maxAcceptRetryDelay
+				}
+				p.warnf("Worker process PID=%d accept connection error: %s; retrying in %s\n",
+					pid,
+					err,
+					acceptRetryDelay,
+				)
+				time.Sleep(acceptRetryDelay)
+				continue
+			}
+			p.errorf("Worker process PID=%d accept connection error: %s\n", pid, err)
+			return err
+		}
+		acceptRetryDelay = 0
+		if p.cfg.LogConnections {
+			p.debugf("New connection accepted from %s/%s\n", conn.RemoteAddr().Network(), conn.RemoteAddr().String())
+		}
+		if p.cfg.ConnFilter != nil && !p.allowConnection(conn) {
+			conn.Close()
 			continue
 		}
-		Logger.Printf("New connection accepted from %s/%s\n", conn.RemoteAddr().Network(), conn.RemoteAddr().String())
-		go handler(conn)
+		if handlerSlots != nil && !p.acquireHandlerSlot(handlerSlots, shuttingDown) {
+			conn.Close()
+			continue
+		}
+		if p.cfg.OnConnectionAccepted != nil {
+			p.callHook("OnConnectionAccepted", func() { p.cfg.OnConnectionAccepted(conn.RemoteAddr()) })
+		}
+		handlers.Add(1)
+		atomic.AddInt64(&p.state.activeConnections, 1)
+		go func() {
+			defer handlers.Done()
+			defer atomic.AddInt64(&p.state.activeConnections, -1)
+			if handlerSlots != nil {
+				defer func() { <-handlerSlots }()
+			}
+			if !p.completeHandshake(conn) {
+				return
+			}
+			handler(conn)
+		}()
+	}
+}
+
+// allowConnection tells if accepted connection passes ConnFilter, rejected connections are logged at debug level only
+func (p *Pack) allowConnection(conn net.Conn) bool {
+	allowed := false
+	p.callHook("ConnFilter", func() { allowed = p.cfg.ConnFilter(conn) })
+	if !allowed {
+		p.debugf("Worker process PID=%d connection from %s/%s rejected by filter\n",
+			pid,
+			conn.RemoteAddr().Network(),
+			conn.RemoteAddr().String(),
+		)
+	}
+
+	return allowed
+}
+
+// acquireHandlerSlot takes a slot for new connection handler according to HandlerLimitPolicy,
+// returns false if connection should be closed
+func (p *Pack) acquireHandlerSlot(handlerSlots chan struct{}, shuttingDown <-chan struct{}) bool {
+	select {
+	case handlerSlots <- struct{}{}:
+		return true
+	default:
+	}
+	if p.cfg.HandlerLimitPolicy == HandlerLimitReject {
+		p.warnf("Worker process PID=%d reached maximum number of concurrent handlers: %d, closing connection\n",
+			pid,
+			p.cfg.MaxConcurrentHandlers,
+		)
+		return false
+	}
+	select {
+	case handlerSlots <- struct{}{}:
+		return true
+	case <-shuttingDown:
+		return false
+	}
+}
+
+// waitForHandlers waits until connection handlers are done but not longer than ctx allows
+func (p *Pack) waitForHandlers(ctx context.Context, handlers *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.warnf("Worker process PID=%d could not shutdown gracefully within %s, active connections: %d\n",
+			pid,
+			p.cfg.ShutdownTimeout,
+			p.ActiveConnections(),
+		)
 	}
 }
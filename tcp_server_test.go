@@ -0,0 +1,87 @@
+package gopherpack
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPServerStopsOnClosedListener(t *testing.T) {
+	p := newSingleProcessPack(0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	l.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- p.ServeTCPContext(context.Background(), l, nil, func(conn net.Conn) { conn.Close() })
+	}()
+	select {
+	case err := <-served:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("server returned %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("accept loop did not exit on closed listener")
+	}
+}
+
+func TestDeadlineConnKeepsCallerDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := &deadlineConn{Conn: server, readTimeout: time.Hour}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("could not set read deadline: %v", err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(make([]byte, 1)); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("read returned %v, want timeout of deadline set by caller", err)
+	}
+
+	// read timeout is applied again once caller resets its deadline
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("could not reset read deadline: %v", err)
+	}
+	go client.Write([]byte{1})
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Errorf("read returned %v after deadline was reset", err)
+	}
+	if conn.NetConn() != server {
+		t.Error("NetConn does not return wrapped connection")
+	}
+}
+
+func TestConnOptionsNetConnReturnsTCPConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer client.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("could not accept: %v", err)
+	}
+	defer conn.Close()
+
+	p := newSingleProcessPack(0)
+	p.cfg.CountBytes = true
+	p.cfg.TCPReadTimeout = time.Second
+	wrapped, ok := p.setConnOptions(conn).(interface{ NetConn() net.Conn })
+	if !ok {
+		t.Fatal("connection is not wrapped")
+	}
+	if _, ok := wrapped.NetConn().(*net.TCPConn); !ok {
+		t.Errorf("NetConn returned %T, want *net.TCPConn", wrapped.NetConn())
+	}
+}
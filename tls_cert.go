@@ -0,0 +1,60 @@
+package gopherpack
+
+import "crypto/tls"
+
+// SetCertificate atomically replaces certificate of TLS servers of current worker process (HTTP and TCP ones),
+// new handshakes use it while established connections are kept. Certificate is served via GetCertificate of
+// tls.Config if caller did not set its own, clients without SNI get tls.Config.Certificates instead if they are set,
+// so leave them empty to serve swapped certificate to all clients
+func SetCertificate(cert *tls.Certificate) {
+	defaultState.currentCert.Store(cert)
+}
+
+// LoadCertificate loads certificate from PEM encoded files and sets it with SetCertificate
+func LoadCertificate(certFile string, keyFile string) error {
+	return defaultPack().LoadCertificate(certFile, keyFile)
+}
+
+// SetCertificate replaces certificate of TLS servers of the pack, see package-level SetCertificate
+func (p *Pack) SetCertificate(cert *tls.Certificate) {
+	p.state.currentCert.Store(cert)
+}
+
+// LoadCertificate loads certificate from PEM encoded files and sets it with SetCertificate of the pack
+func (p *Pack) LoadCertificate(certFile string, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	p.SetCertificate(&cert)
+
+	return nil
+}
+
+// getCertificate returns certificate set by SetCertificate, nil makes TLS to use tls.Config.Certificates
+func (p *Pack) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := p.state.currentCert.Load().(*tls.Certificate)
+
+	return cert, nil
+}
+
+// setCertificateGetter makes tlsConfig owned by gopherpack to serve certificate set by SetCertificate
+func (p *Pack) setCertificateGetter(tlsConfig *tls.Config) {
+	if tlsConfig == nil || tlsConfig.GetCertificate != nil {
+		return
+	}
+	tlsConfig.GetCertificate = p.getCertificate
+}
+
+// loadTLSCertFile loads certificate of TLSCertFile and TLSKeyFile if they are set
+func (p *Pack) loadTLSCertFile() error {
+	if p.cfg.TLSCertFile == "" {
+		return nil
+	}
+	if err := p.LoadCertificate(p.cfg.TLSCertFile, p.cfg.TLSKeyFile); err != nil {
+		return err
+	}
+	p.infof("%s PID=%d loaded TLS certificate %s\n", p.processName(), pid, p.cfg.TLSCertFile)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package gopherpack
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"os"
+	"sync"
+)
+
+// session ticket key passed by main process if ShareTLSSessionTickets is set
+var (
+	inheritedTicketKey = inheritedFile(envTLSTicketKeyFD, "gopherpack-tls-ticket-key")
+	ticketKeysOnce     sync.Once
+	ticketKeys         [][32]byte
+)
+
+// TLSSessionTicketKeys returns TLS session ticket keys shared by all worker processes of the pack
+// if ShareTLSSessionTickets is set (i.e. to pass them to SetSessionTicketKeys of tls.Config of gRPC server),
+// nil is returned in main process and if keys are not shared
+func TLSSessionTicketKeys() [][32]byte {
+	ticketKeysOnce.Do(func() {
+		if inheritedTicketKey == nil {
+			return
+		}
+		defer inheritedTicketKey.Close()
+		var key [32]byte
+		if _, err := io.ReadFull(inheritedTicketKey, key[:]); err != nil {
+			return
+		}
+		ticketKeys = [][32]byte{key}
+	})
+
+	return ticketKeys
+}
+
+// setSessionTicketKeys makes tlsConfig owned by gopherpack to use session ticket keys shared by the pack if any
+func setSessionTicketKeys(tlsConfig *tls.Config) {
+	keys := TLSSessionTicketKeys()
+	if tlsConfig == nil || len(keys) == 0 || tlsConfig.SessionTicketsDisabled {
+		return
+	}
+	tlsConfig.SetSessionTicketKeys(keys)
+}
+
+// newTicketKey generates session ticket key in main process
+func newTicketKey() (*[32]byte, error) {
+	var key [32]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ticketKeyFile returns pipe which passes session ticket key to worker process without exposing it in environment
+func ticketKeyFile(key *[32]byte) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	if _, err := w.Write(key[:]); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
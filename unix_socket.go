@@ -0,0 +1,46 @@
+package gopherpack
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+func isUnixNetwork(network string) bool {
+	return network == "unix" || network == "unixgram" || network == "unixpacket"
+}
+
+// removeStaleUnixSocket removes socket file left by a process which is not listening anymore,
+// socket of a live listener (i.e. of another worker process) is kept, so first binder wins,
+// socket in abstract namespace is gone with its last listener, so there is nothing to remove
+func (p *Pack) removeStaleUnixSocket(network string, address string) {
+	if isAbstractUnixSocket(address) {
+		return
+	}
+	if _, err := os.Stat(address); err != nil {
+		return
+	}
+	conn, err := net.Dial(network, address)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return
+	}
+	if err := os.Remove(address); err != nil {
+		p.warnf("Could not remove stale unix socket %s: %s\n", address, err)
+		return
+	}
+	p.infof("Removed stale unix socket %s\n", address)
+}
+
+// setUnixSocketMode sets configured permissions of unix socket file, it is skipped for socket in abstract namespace
+func (p *Pack) setUnixSocketMode(address string) error {
+	if p.cfg.UnixSocketMode == 0 || isAbstractUnixSocket(address) {
+		return nil
+	}
+
+	return os.Chmod(address, p.cfg.UnixSocketMode)
+}
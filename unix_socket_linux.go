@@ -0,0 +1,12 @@
+//go:build linux
+// +build linux
+
+package gopherpack
+
+import "strings"
+
+// isAbstractUnixSocket tells if unix socket address starting with "@" is in abstract namespace
+// (Go translates leading "@" to null byte), there is no socket file for it to remove or chmod
+func isAbstractUnixSocket(address string) bool {
+	return strings.HasPrefix(address, "@")
+}
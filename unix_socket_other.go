@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package gopherpack
+
+// isAbstractUnixSocket returns false as abstract namespace of unix sockets is available only on Linux
+func isAbstractUnixSocket(address string) bool {
+	return false
+}
@@ -0,0 +1,153 @@
+package gopherpack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// upgradeState tracks executable upgrade started by main process, upgrade is in progress
+// from reload signal until new main process takes over or all attempts to start it fail
+type upgradeState struct {
+	inProgress bool
+	// number of failed attempts of current upgrade
+	failures int
+	// gets notified if new main process exits before it terminates current main process
+	exited chan upgradeExit
+	// fires when failed upgrade should be retried, nil if no retry is scheduled
+	retry <-chan time.Time
+}
+
+// upgradeExit describes new main process which exited before taking over
+type upgradeExit struct {
+	pid int
+	err error
+}
+
+func newUpgradeState() *upgradeState {
+	return &upgradeState{exited: make(chan upgradeExit, 1)}
+}
+
+// startUpgrade starts new main process with upgraded executable, current main process keeps serving
+// until new main process terminates it, failed attempts are retried according to UpgradeRetries
+func (p *Pack) startUpgrade(u *upgradeState, listenerFile *os.File) {
+	u.inProgress = true
+	u.retry = nil
+	// call a hook if needed
+	if p.cfg.OnSIGUSR2 != nil {
+		p.callHook("OnSIGUSR2", p.cfg.OnSIGUSR2)
+	}
+	if p.cfg.OnUpgrade != nil {
+		upgradeErr := errors.New("OnUpgrade hook panicked")
+		p.callHook("OnUpgrade", func() { upgradeErr = p.cfg.OnUpgrade() })
+		if upgradeErr != nil {
+			p.warnf("Main process PID=%d executable upgrade aborted: %s\n", pid, upgradeErr)
+			u.inProgress = false
+			return
+		}
+	}
+	p.infof("Main process PID=%d starting new main process\n", pid)
+	// send current main process PID via env var so new main process will know
+	// which process to kill after successful start
+	envValues := []string{
+		fmt.Sprintf("%s=%d", envPrevPPID, pid),
+	}
+	// new main process inherits shared listener too
+	extraFiles := []*os.File{}
+	if listenerFile != nil {
+		envValues = append(envValues, fmt.Sprintf("%s=%d", envListenerFD, extraFileFD(0)))
+		extraFiles = append(extraFiles, listenerFile)
+	}
+	newMainPID := 0
+	// new main process is registered before orphan reaper can see it, its exit status is taken by Wait below
+	p.state.waitedChildrenMu.Lock()
+	newMainProcess, err := p.forkProcess(true, envValues, extraFiles...)
+	if err == nil {
+		p.state.waitedChildren[newMainProcess.Pid] = true
+	}
+	p.state.waitedChildrenMu.Unlock()
+	if err != nil {
+		p.errorf("Main process PID=%d could not start new main process: %s\n",
+			pid, err)
+	} else {
+		newMainPID = newMainProcess.Pid
+		p.infof("Main process PID=%d new main process PID=%d has started\n",
+			pid, newMainPID)
+	}
+	if p.cfg.OnUpgradeResult != nil {
+		p.callHook("OnUpgradeResult", func() { p.cfg.OnUpgradeResult(newMainPID, err) })
+	}
+	if err != nil {
+		p.retryUpgrade(u)
+		return
+	}
+
+	// new main process runs until current one is terminated if upgrade succeeds
+	go func() {
+		state, err := newMainProcess.Wait()
+		p.state.waitedChildrenMu.Lock()
+		delete(p.state.waitedChildren, newMainPID)
+		p.state.waitedChildrenMu.Unlock()
+		if err == nil {
+			err = fmt.Errorf("new main process PID=%d exited with status: %s", newMainPID, state)
+		}
+		u.exited <- upgradeExit{pid: newMainPID, err: err}
+	}()
+}
+
+// upgradeFailed handles new main process which exited before taking over, current main process keeps serving
+func (p *Pack) upgradeFailed(u *upgradeState, exit upgradeExit) {
+	p.errorf("Main process PID=%d executable upgrade failed, keep serving: %s\n", pid, exit.err)
+	if p.cfg.OnUpgradeResult != nil {
+		p.callHook("OnUpgradeResult", func() { p.cfg.OnUpgradeResult(exit.pid, exit.err) })
+	}
+	p.retryUpgrade(u)
+}
+
+// retryUpgrade schedules next attempt of failed upgrade or finishes upgrade if there are no attempts left
+func (p *Pack) retryUpgrade(u *upgradeState) {
+	u.failures++
+	if u.failures > p.cfg.UpgradeRetries {
+		if p.cfg.UpgradeRetries > 0 {
+			p.errorf("Main process PID=%d executable upgrade failed %d times, giving up\n", pid, u.failures)
+		}
+		u.inProgress = false
+		return
+	}
+	p.infof("Main process PID=%d retrying executable upgrade in %s\n", pid, p.cfg.UpgradeRetryBackoff)
+	u.retry = time.After(p.cfg.UpgradeRetryBackoff)
+}
+
+// takeOver terminates previous main process once workers of new main process are ready,
+// aborted is closed if they are not ready within UpgradeGraceInterval so previous main process keeps serving
+func (p *Pack) takeOver(workers *supervisor, prevMainPIDStr string, aborted chan<- struct{}) {
+	// let new main process and previous main process co-exist until new workers are ready
+	if !workers.waitReady(p.cfg.UpgradeGraceInterval) {
+		if !workers.isStopping() {
+			p.errorf("Main process PID=%d workers are not ready after %s, keeping previous main process PID=%s\n",
+				pid, p.cfg.UpgradeGraceInterval, prevMainPIDStr)
+			close(aborted)
+		}
+		return
+	}
+	if p.cfg.PIDFile != "" {
+		if err := p.writePIDFile(); err != nil {
+			p.errorf("Main process PID=%d could not write PID file: %s\n", pid, err)
+		}
+	}
+	// send SIGTERM to previous main process
+	prevMainPID, err := strconv.Atoi(prevMainPIDStr)
+	if err != nil {
+		p.errorf("Main process PID=%d could not parse previous PID: %s\n",
+			pid, err)
+	} else if prevProcess, err := os.FindProcess(prevMainPID); err != nil {
+		p.errorf("Main process PID=%d could not find process for previous PID=%d: %s\n",
+			pid, prevMainPID, err)
+	} else if err := prevProcess.Signal(syscall.SIGTERM); err != nil {
+		p.errorf("Main process PID=%d could not send SIGTERM to previous PID=%d: %s\n",
+			pid, prevMainPID, err)
+	}
+}
@@ -0,0 +1,101 @@
+package gopherpack
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startPrevMainProcess starts process standing for previous main process, returned channel gets its exit status
+func startPrevMainProcess(t *testing.T) (*exec.Cmd, <-chan error) {
+	t.Helper()
+	prevMain := exec.Command("sleep", "30")
+	if err := prevMain.Start(); err != nil {
+		t.Fatalf("could not start previous main process: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- prevMain.Wait() }()
+	t.Cleanup(func() { prevMain.Process.Kill() })
+
+	return prevMain, exited
+}
+
+func TestTakeOverWaitsForReadyWorkers(t *testing.T) {
+	p := newTestPack(t)
+	p.cfg.UpgradeGraceInterval = 5 * time.Second
+	stubAffinity(t, nil)
+	workers := newSupervisor(p, 1, []int{0}, nil)
+	if started := workers.start(); started != 1 {
+		t.Fatalf("started %d worker processes, want 1", started)
+	}
+	defer workers.stop(syscall.SIGTERM)
+	prevMain, exited := startPrevMainProcess(t)
+
+	aborted := make(chan struct{})
+	go p.takeOver(workers, strconv.Itoa(prevMain.Process.Pid), aborted)
+	// previous main process keeps running while worker process of new one is not ready
+	select {
+	case err := <-exited:
+		t.Fatalf("previous main process exited before worker process is ready: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	workers.mu.Lock()
+	process := workers.workers[0].process
+	workers.mu.Unlock()
+	workers.setReady(process)
+	select {
+	case err := <-exited:
+		if !isTerminatedBy(err, syscall.SIGTERM) {
+			t.Errorf("previous main process exited with %v, want SIGTERM", err)
+		}
+	case <-aborted:
+		t.Fatal("upgrade is aborted")
+	case <-time.After(5 * time.Second):
+		t.Fatal("previous main process is not terminated once worker process is ready")
+	}
+}
+
+func TestTakeOverAbortsAfterGraceInterval(t *testing.T) {
+	p := newTestPack(t)
+	p.cfg.UpgradeGraceInterval = 200 * time.Millisecond
+	stubAffinity(t, nil)
+	workers := newSupervisor(p, 1, []int{0}, nil)
+	if started := workers.start(); started != 1 {
+		t.Fatalf("started %d worker processes, want 1", started)
+	}
+	defer workers.stop(syscall.SIGTERM)
+	prevMain, exited := startPrevMainProcess(t)
+
+	takeOverStarted := time.Now()
+	aborted := make(chan struct{})
+	go p.takeOver(workers, strconv.Itoa(prevMain.Process.Pid), aborted)
+	select {
+	case <-aborted:
+		if elapsed := time.Since(takeOverStarted); elapsed < p.cfg.UpgradeGraceInterval {
+			t.Errorf("upgrade is aborted after %s, before grace interval", elapsed)
+		}
+	case err := <-exited:
+		t.Fatalf("previous main process exited although worker process is not ready: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("upgrade is not aborted after grace interval")
+	}
+	select {
+	case err := <-exited:
+		t.Errorf("previous main process exited after upgrade is aborted: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// isTerminatedBy tells if exit error of a command says it was terminated by sig
+func isTerminatedBy(err error, sig syscall.Signal) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+
+	return ok && status.Signaled() && status.Signal() == sig
+}